@@ -0,0 +1,156 @@
+package ans
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// rANS, the range variant of ANS. Coding symbol s with frequency f and cumulative frequency c
+// out of M = 2^precision takes the state x to
+//
+//	x' = (x / f) * M + c + x % f
+//
+// and decoding takes it back: x' % M is in [c, c+f), which gives s, and
+//
+//	x = f * (x' / M) + x' % M - c
+//
+// The state is kept in [L, 256*L) with L = 2^23. Before coding a symbol, the encoder moves bytes
+// out of the bottom of x until x' will fit, and after decoding one the decoder moves bytes back in
+// until x is at least L again. Decoding runs in the opposite order to encoding, so the encoder
+// works from the last symbol to the first and the bytes it writes are reversed at the end.
+//
+// Lanes states are kept, and symbol i is coded with state i%Lanes. The states don't depend on
+// each other, so the CPU can work on several symbols at once; all lanes share one stream of bytes.
+//
+// Coded data:
+//
+//	states  [Lanes]uint32  final states of the encoder, where the decoder starts
+//	data                   renormalization bytes in the order the decoder reads them
+//
+// Every lane starts at L in the encoder, so the decoder must end with every lane at L.
+
+const Lanes = 4
+
+const ransL = 1 << 23
+
+var errCorrupt = errors.New("ans: corrupt data")
+
+// Code n symbols. sym gives the cumulative frequency and frequency of symbol i.
+func ransEncode(n int, precision uint, sym func(i int) (uint32, uint32)) []byte {
+	var states [Lanes]uint32
+	for l := range states {
+		states[l] = ransL
+	}
+	// Bytes in the order they are written, which is the reverse of how they are read.
+	rev := make([]byte, 0, n/2+16)
+	for i := n - 1; i >= 0; i-- {
+		c, f := sym(i)
+		x := states[i%Lanes]
+		limit := ((ransL >> precision) << 8) * f
+		for x >= limit {
+			rev = append(rev, byte(x))
+			x >>= 8
+		}
+		states[i%Lanes] = (x/f)<<precision + x%f + c
+	}
+	out := make([]byte, 4*Lanes+len(rev))
+	for l, x := range states {
+		binary.BigEndian.PutUint32(out[4*l:], x)
+	}
+	data := out[4*Lanes:]
+	for i, b := range rev {
+		data[len(rev)-1-i] = b
+	}
+	return out
+}
+
+// Decode len(out) symbols from coded into out with the frequencies in t. update, if not nil,
+// is called with every symbol decoded, and may change t.
+func ransDecode(out []byte, coded []byte, t *Table, update func(s byte)) error {
+	if len(coded) < 4*Lanes {
+		return io.ErrUnexpectedEOF
+	}
+	var states [Lanes]uint32
+	for l := range states {
+		states[l] = binary.BigEndian.Uint32(coded[4*l:])
+		if states[l] < ransL {
+			return errCorrupt
+		}
+	}
+	data := coded[4*Lanes:]
+	pos := 0
+	precision := t.precision
+	mask := uint32(1)<<precision - 1
+	for i := range out {
+		x := states[i%Lanes]
+		slot := x & mask
+		s := t.find(slot)
+		out[i] = byte(s)
+		x = t.freq[s]*(x>>precision) + slot - t.cum[s]
+		for x < ransL {
+			if pos == len(data) {
+				return io.ErrUnexpectedEOF
+			}
+			x = x<<8 | uint32(data[pos])
+			pos++
+		}
+		states[i%Lanes] = x
+		if update != nil {
+			update(out[i])
+		}
+	}
+	if pos != len(data) {
+		return errors.New("ans: extra data at end")
+	}
+	for _, x := range states {
+		if x != ransL {
+			return errCorrupt
+		}
+	}
+	return nil
+}
+
+// Encode codes data with the frequencies in t, and returns the coded bytes.
+func (t *Table) Encode(data []byte) ([]byte, error) {
+	for _, x := range data {
+		if int(x) >= len(t.freq) || t.freq[x] == 0 {
+			return nil, errSymbol
+		}
+	}
+	return ransEncode(len(data), t.precision, func(i int) (uint32, uint32) {
+		x := data[i]
+		return t.cum[x], t.freq[x]
+	}), nil
+}
+
+// Decode decodes len(out) symbols coded by Encode with the same frequencies into out.
+func (t *Table) Decode(out []byte, coded []byte) error {
+	return ransDecode(out, coded, t, nil)
+}
+
+// Encode codes data, updating the table after every symbol, and returns the coded bytes.
+// The symbols have to be coded last to first, so the table is run over data first and the
+// frequencies used for each symbol are kept.
+func (a *Adaptive) Encode(data []byte) ([]byte, error) {
+	for _, x := range data {
+		if int(x) >= len(a.freq) {
+			return nil, errSymbol
+		}
+	}
+	syms := make([]uint32, 2*len(data))
+	for i, x := range data {
+		syms[2*i] = a.cum[x]
+		syms[2*i+1] = a.freq[x]
+		a.Update(x)
+	}
+	return ransEncode(len(data), a.precision, func(i int) (uint32, uint32) {
+		return syms[2*i], syms[2*i+1]
+	}), nil
+}
+
+// Decode decodes len(out) symbols coded by Encode into out. The table must start out in the
+// same state as the one given to Encode, and is updated the same way.
+func (a *Adaptive) Decode(out []byte, coded []byte) error {
+	return ransDecode(out, coded, &a.Table, a.Update)
+}
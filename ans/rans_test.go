@@ -0,0 +1,120 @@
+package ans
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// n random bytes from a skewed distribution, and their counts.
+func testData(n int, seed int64) ([]byte, []int) {
+	r := rand.New(rand.NewSource(seed))
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(r.ExpFloat64() * 8)
+	}
+	counts := make([]int, 256)
+	for _, x := range data {
+		counts[x]++
+	}
+	return data, counts
+}
+
+// Bytes of an ideal code for data with the frequencies in counts.
+func entropyBytes(counts []int) float64 {
+	n := 0
+	for _, c := range counts {
+		n += c
+	}
+	bits := 0.0
+	for _, c := range counts {
+		if c > 0 {
+			bits -= float64(c) * math.Log2(float64(c)/float64(n))
+		}
+	}
+	return bits / 8
+}
+
+func TestNormalize(t *testing.T) {
+	_, counts := testData(10000, 1)
+	counts[200] = 1
+	for precision := uint(MinPrecision); precision <= MaxPrecision; precision++ {
+		freqs, err := Normalize(counts, precision)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum := uint32(0)
+		for s, f := range freqs {
+			if (f == 0) != (counts[s] == 0) {
+				t.Errorf("precision %d: symbol %d has count %d and frequency %d", precision, s, counts[s], f)
+			}
+			sum += f
+		}
+		if sum != 1<<precision {
+			t.Errorf("precision %d: frequencies add up to %d", precision, sum)
+		}
+	}
+	if _, err := Normalize(counts, MaxPrecision+1); err == nil {
+		t.Error("precision too high")
+	}
+	if _, err := Normalize(make([]int, 256), DefaultPrecision); err == nil {
+		t.Error("no symbols")
+	}
+}
+
+// A static and an adaptive table at every precision decode again, and the static code is
+// close to the entropy.
+func TestRANS(t *testing.T) {
+	data, counts := testData(50000, 1)
+	entropy := entropyBytes(counts)
+	for precision := uint(MinPrecision); precision <= MaxPrecision; precision++ {
+		freqs, err := Normalize(counts, precision)
+		if err != nil {
+			t.Fatal(err)
+		}
+		table, err := NewTable(freqs, precision)
+		if err != nil {
+			t.Fatal(err)
+		}
+		coded, err := table.Encode(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := make([]byte, len(data))
+		if err := table.Decode(out, coded); err != nil || !bytes.Equal(out, data) {
+			t.Errorf("static, precision %d: decoded data does not match, %v", precision, err)
+		}
+		if float64(len(coded)) > entropy*1.005+4*Lanes+4 {
+			t.Errorf("static, precision %d: %d bytes, entropy is %.0f", precision, len(coded), entropy)
+		}
+
+		a, _ := NewAdaptive(256, precision)
+		coded, err = a.Encode(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := NewAdaptive(256, precision)
+		if err := b.Decode(out, coded); err != nil || !bytes.Equal(out, data) {
+			t.Errorf("adaptive, precision %d: decoded data does not match, %v", precision, err)
+		}
+	}
+}
+
+// Corrupt data is found by the final states, or the amount of data read.
+func TestRANSCorrupt(t *testing.T) {
+	data, counts := testData(1000, 2)
+	freqs, _ := Normalize(counts, DefaultPrecision)
+	table, _ := NewTable(freqs, DefaultPrecision)
+	coded, _ := table.Encode(data)
+	out := make([]byte, len(data))
+	if table.Decode(out, coded[:len(coded)-1]) == nil {
+		t.Error("truncated data decoded")
+	}
+	if table.Decode(out, append(coded, 0)) == nil {
+		t.Error("data with an extra byte decoded")
+	}
+	if table.Decode(out, coded[:4*Lanes-1]) == nil {
+		t.Error("missing states decoded")
+	}
+}
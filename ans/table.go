@@ -0,0 +1,225 @@
+package ans
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Asymmetric numeral systems, from Duda, "Asymmetric numeral systems: entropy coding combining
+// speed of Huffman coding with compression rate of arithmetic coding" (2013).
+// https://arxiv.org/abs/1311.2540
+//
+// Symbols are bytes. Every symbol gets a frequency out of a total of M = 2^precision, like the
+// probabilities given to ops.ArithEncoder, and the coder keeps its whole state in one integer x.
+// Coding a symbol s with frequency f turns x into about x*M/f, so log2(M/f) bits are added to x,
+// and whole bytes are moved out of x into the output whenever it grows too big.
+//
+// This file turns counts into frequencies. rans.go codes with them by arithmetic, tans.go by
+// table lookup.
+
+// Range of precisions that can be used. Below 12 the rounding of the frequencies costs too much,
+// above 16 the rANS state no longer has room for a byte of renormalization.
+const (
+	MinPrecision     = 12
+	MaxPrecision     = 16
+	DefaultPrecision = 14
+)
+
+var errPrecision = fmt.Errorf("ans: precision must be between %d and %d", MinPrecision, MaxPrecision)
+
+var errSymbol = errors.New("ans: symbol has frequency 0")
+
+// Normalize scales counts so they add up to 2^precision, keeping every symbol that was counted
+// at a frequency of at least 1. Where rounding leaves the total off, the frequencies that cost the
+// fewest bits to change are moved.
+//
+// If only one symbol was counted, it gets 2^precision-1 and the symbol next to it (s^1) gets 1,
+// so no frequency takes up the whole range. counts must then have room for s^1.
+func Normalize(counts []int, precision uint) ([]uint32, error) {
+	if precision < MinPrecision || precision > MaxPrecision {
+		return nil, errPrecision
+	}
+	if len(counts) > 256 {
+		return nil, errors.New("ans: more than 256 symbols")
+	}
+	m := uint64(1) << precision
+	total := uint64(0)
+	used := 0
+	last := 0
+	for s, c := range counts {
+		if c < 0 {
+			return nil, errors.New("ans: negative count")
+		}
+		if c > 0 {
+			total += uint64(c)
+			used++
+			last = s
+		}
+	}
+	if used == 0 {
+		return nil, errors.New("ans: no symbols counted")
+	}
+	freqs := make([]uint32, len(counts))
+	if used == 1 {
+		if last^1 >= len(counts) {
+			return nil, errors.New("ans: no room to pair a single symbol")
+		}
+		freqs[last] = uint32(m - 1)
+		freqs[last^1] = 1
+		return freqs, nil
+	}
+	sum := uint64(0)
+	for s, c := range counts {
+		if c == 0 {
+			continue
+		}
+		f := uint64(c) * m / total
+		if f == 0 {
+			f = 1
+		}
+		freqs[s] = uint32(f)
+		sum += f
+	}
+	// Changing f by one changes the code length of every one of the c symbols by about 1/f bits,
+	// so the cost of a change is c/f. Compare c1/f1 and c2/f2 as c1*f2 and c2*f1.
+	for ; sum < m; sum++ {
+		best := -1
+		for s, c := range counts {
+			if c > 0 && (best < 0 || uint64(c)*uint64(freqs[best]) > uint64(counts[best])*uint64(freqs[s])) {
+				best = s
+			}
+		}
+		freqs[best]++
+	}
+	for ; sum > m; sum-- {
+		best := -1
+		for s, c := range counts {
+			if freqs[s] > 1 && (best < 0 || uint64(c)*uint64(freqs[best]) < uint64(counts[best])*uint64(freqs[s])) {
+				best = s
+			}
+		}
+		freqs[best]--
+	}
+	return freqs, nil
+}
+
+// Table holds normalized frequencies as cumulative counts, for coding with rANS.
+type Table struct {
+	precision uint
+	freq      []uint32
+	cum       []uint32 // cum[s] is the sum of the frequencies of the symbols before s
+	slots     []uint8  // symbol for every value in [0, 2^precision), nil to search cum instead
+}
+
+// NewTable returns a table for freqs, which must add up to 2^precision (see Normalize).
+func NewTable(freqs []uint32, precision uint) (*Table, error) {
+	t, err := newTable(freqs, precision)
+	if err != nil {
+		return nil, err
+	}
+	t.slots = make([]uint8, 1<<precision)
+	for s, f := range freqs {
+		for i := t.cum[s]; i < t.cum[s]+f; i++ {
+			t.slots[i] = uint8(s)
+		}
+	}
+	return t, nil
+}
+
+func newTable(freqs []uint32, precision uint) (*Table, error) {
+	if precision < MinPrecision || precision > MaxPrecision {
+		return nil, errPrecision
+	}
+	if len(freqs) > 256 {
+		return nil, errors.New("ans: more than 256 symbols")
+	}
+	t := &Table{precision: precision, freq: freqs, cum: make([]uint32, len(freqs)+1)}
+	t.setCum()
+	if t.cum[len(freqs)] != 1<<precision {
+		return nil, fmt.Errorf("ans: frequencies must add up to %d", 1<<precision)
+	}
+	return t, nil
+}
+
+func (t *Table) setCum() {
+	for s, f := range t.freq {
+		t.cum[s+1] = t.cum[s] + f
+	}
+}
+
+// Precision is the number of bits the frequencies add up to.
+func (t *Table) Precision() uint {
+	return t.precision
+}
+
+// Freqs returns the frequency of every symbol. It must not be changed.
+func (t *Table) Freqs() []uint32 {
+	return t.freq
+}
+
+// Symbol whose range [cum, cum+freq) holds slot.
+func (t *Table) find(slot uint32) int {
+	if t.slots != nil {
+		return int(t.slots[slot])
+	}
+	return sort.Search(len(t.freq), func(s int) bool { return t.cum[s+1] > slot })
+}
+
+// Adaptive is a table that follows the data. It counts every symbol it is given, and normalizes
+// the counts again every so often: after 16 symbols at first, doubling up to every 1024.
+// Every symbol starts with a count of 1, so any symbol can be coded at any time.
+type Adaptive struct {
+	Table
+	counts   []int
+	total    int
+	seen     int
+	interval int
+}
+
+// Counts are halved when they add up to more than this, so old data is slowly forgotten.
+const adaptiveLimit = 1 << 16
+
+const maxInterval = 1024
+
+// NewAdaptive returns an Adaptive table for symbols 0 to symbols-1.
+func NewAdaptive(symbols int, precision uint) (*Adaptive, error) {
+	a := &Adaptive{counts: make([]int, symbols), total: symbols, interval: 16}
+	for s := range a.counts {
+		a.counts[s] = 1
+	}
+	freqs, err := Normalize(a.counts, precision)
+	if err != nil {
+		return nil, err
+	}
+	t, err := newTable(freqs, precision)
+	if err != nil {
+		return nil, err
+	}
+	a.Table = *t
+	return a, nil
+}
+
+// Update counts s, and normalizes the counts again if it is time to.
+func (a *Adaptive) Update(s byte) {
+	a.counts[s]++
+	a.total++
+	if a.total > adaptiveLimit {
+		a.total = 0
+		for i, c := range a.counts {
+			a.counts[i] = (c + 1) / 2
+			a.total += a.counts[i]
+		}
+	}
+	a.seen++
+	if a.seen < a.interval {
+		return
+	}
+	a.seen = 0
+	if a.interval < maxInterval {
+		a.interval *= 2
+	}
+	// Can't fail, every count is at least 1 and the precision was checked by NewAdaptive.
+	a.freq, _ = Normalize(a.counts, a.precision)
+	a.setCum()
+}
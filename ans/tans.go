@@ -0,0 +1,287 @@
+package ans
+
+import (
+	bitio "compression/bitio"
+	"errors"
+	"io"
+	"math/bits"
+)
+
+// tANS, the tabled variant of ANS, as in Collet's Finite State Entropy (FSE).
+// https://github.com/Cyan4973/FiniteStateEntropy
+//
+// With L = 2^precision, the state x is kept in [L, 2L), and every state belongs to one symbol:
+// the symbols are spread over the L states, each symbol s getting f(s) of them. The spread jumps
+// through the table by a fixed odd step, so every symbol is scattered over the whole range.
+//
+// To decode, the symbol is looked up from x, x is replaced with the state's number among the states
+// of its symbol (a number in [f, 2f)), and bits are read into the bottom of that until it is back
+// in [L, 2L). Both the symbol and how many bits to read depend only on x, so decoding is one table
+// lookup and one read per symbol:
+//
+//	s, nbBits, base = decode[x-L]
+//	x = L + base + readBits(nbBits)
+//
+// Encoding does the opposite, from the last symbol to the first: bits are moved out of the bottom of
+// x until it is in [f, 2f), and the state for that number is looked up in a table. The encoder's bits
+// come out in reverse, so they are kept and written in the order the decoder reads them.
+//
+// Coded data, as bits:
+//
+//	state   precision bits   final state of the encoder minus L, where the decoder starts
+//	bits                     bits of every symbol in order
+//
+// The encoder starts at x = L, so the decoder must end there too.
+
+// Entry of the decode table.
+type fseDecode struct {
+	symbol uint8
+	nbBits uint8
+	base   uint32 // x-L after the symbol, before the bits read are added
+}
+
+// Encoding transform of a symbol. For a state x, the number of bits to move out is
+// (x + deltaNbBits) >> 16, and the next state is states[(x >> nbBits) + deltaFindState].
+type fseEncode struct {
+	deltaNbBits    uint32
+	deltaFindState int32
+}
+
+// FSE holds the tANS tables for a set of normalized frequencies.
+type FSE struct {
+	precision uint
+	freq      []uint32
+	decode    []fseDecode
+	states    []uint32 // x of every state, sorted by symbol
+	encode    []fseEncode
+}
+
+// Spread step from FSE. It is odd, so it visits every position of a power of two table.
+func spreadStep(size uint32) uint32 {
+	return size>>1 + size>>3 + 3
+}
+
+// NewFSE builds the tables for freqs, which must add up to 2^precision (see Normalize).
+func NewFSE(freqs []uint32, precision uint) (*FSE, error) {
+	// Checks the frequencies.
+	_, err := newTable(freqs, precision)
+	if err != nil {
+		return nil, err
+	}
+	size := uint32(1) << precision
+	t := &FSE{
+		precision: precision,
+		freq:      freqs,
+		decode:    make([]fseDecode, size),
+		states:    make([]uint32, size),
+		encode:    make([]fseEncode, len(freqs)),
+	}
+
+	// Spread the symbols over the states.
+	spread := make([]uint8, size)
+	pos := uint32(0)
+	step := spreadStep(size)
+	for s, f := range freqs {
+		for i := uint32(0); i < f; i++ {
+			spread[pos] = uint8(s)
+			pos = (pos + step) & (size - 1)
+		}
+	}
+
+	// Number the states of every symbol from f to 2f-1, in order.
+	next := make([]uint32, len(freqs))
+	copy(next, freqs)
+	cum := make([]uint32, len(freqs))
+	total := uint32(0)
+	for s, f := range freqs {
+		cum[s] = total
+		total += f
+	}
+	for u, s := range spread {
+		xs := next[s]
+		next[s]++
+		nbBits := uint32(precision) + 1 - uint32(bits.Len32(xs))
+		t.decode[u] = fseDecode{symbol: s, nbBits: uint8(nbBits), base: xs<<nbBits - size}
+		t.states[cum[s]+xs-freqs[s]] = size + uint32(u)
+	}
+
+	// A state x in [L, 2L) of symbol s with frequency f moves out maxBits bits if x >= f << maxBits,
+	// and one less if not. Adding deltaNbBits makes the number of bits the top 16 bits of the sum.
+	for s, f := range freqs {
+		if f == 0 {
+			continue
+		}
+		maxBits := uint32(precision) + 1 - uint32(bits.Len32(f-1))
+		t.encode[s] = fseEncode{
+			deltaNbBits:    maxBits<<16 - f<<maxBits,
+			deltaFindState: int32(cum[s]) - int32(f),
+		}
+	}
+	return t, nil
+}
+
+// Precision is the number of bits the frequencies add up to.
+func (t *FSE) Precision() uint {
+	return t.precision
+}
+
+// Encode codes data and writes it to w.
+func (t *FSE) Encode(w *bitio.BitWriter, data []byte) error {
+	for _, x := range data {
+		if int(x) >= len(t.freq) || t.freq[x] == 0 {
+			return errSymbol
+		}
+	}
+	size := uint32(1) << t.precision
+	// Bits of every symbol, as value<<8 | nbBits. Values have at most precision bits.
+	out := make([]uint32, len(data))
+	x := size
+	for i := len(data) - 1; i >= 0; i-- {
+		e := t.encode[data[i]]
+		nbBits := (x + e.deltaNbBits) >> 16
+		out[i] = (x&(uint32(1)<<nbBits-1))<<8 | nbBits
+		x = t.states[int32(x>>nbBits)+e.deltaFindState]
+	}
+	err := w.WriteBits(uint64(x-size), t.precision)
+	if err != nil {
+		return err
+	}
+	for _, v := range out {
+		err = w.WriteBits(uint64(v>>8), uint(v&0xff))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Decode decodes len(out) symbols coded by Encode with the same frequencies from r into out.
+// r must read bits in the order w was written in.
+func (t *FSE) Decode(r *bitio.BitReader, out []byte) error {
+	v, err := r.ReadBits(t.precision)
+	if err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	u := uint32(v)
+	msb := r.Order() == bitio.MSB
+	for i := 0; i < len(out); {
+		// Peek as many bits as possible and decode from them while there are enough for any
+		// symbol, then skip what was used. Skip finds out if that was more than there is.
+		buf, err := r.PeekBits(bitio.MaxPeek)
+		if err != nil {
+			return err
+		}
+		used := uint(0)
+		for ; i < len(out) && used+t.precision <= bitio.MaxPeek; i++ {
+			e := t.decode[u]
+			out[i] = e.symbol
+			n := uint(e.nbBits)
+			if msb {
+				v = buf >> (bitio.MaxPeek - used - n)
+			} else {
+				v = buf >> used
+			}
+			u = e.base + uint32(v)&(uint32(1)<<n-1)
+			used += n
+		}
+		if r.Skip(used) != nil {
+			return io.ErrUnexpectedEOF
+		}
+	}
+	if u != 0 {
+		return errCorrupt
+	}
+	return nil
+}
+
+// Normalized frequencies are written as bits, one symbol after another, like FSE does it:
+//
+//	precision  5 bits
+//	freq       as many bits as it takes to write the frequency left over for the rest of the
+//	           symbols, so the fields get shorter as the frequencies are used up
+//	zeros      after a frequency of 0, how many more symbols in a row have frequency 0, written
+//	           2 bits at a time: 3 means 3 more and another 2 bits follow
+//
+// The list stops once the frequencies add up to 2^precision; the symbols after that have frequency 0.
+
+// WriteCounts writes freqs, which must add up to 2^precision, to w.
+func WriteCounts(w *bitio.BitWriter, freqs []uint32, precision uint) error {
+	if precision < MinPrecision || precision > MaxPrecision {
+		return errPrecision
+	}
+	sum := uint64(0)
+	for _, f := range freqs {
+		sum += uint64(f)
+	}
+	if sum > 1<<precision {
+		return errors.New("ans: frequencies add up to too much")
+	}
+	if sum < 1<<precision {
+		return errors.New("ans: frequencies add up to too little")
+	}
+	w.WriteBits(uint64(precision), 5)
+	left := uint32(1) << precision
+	for s := 0; s < len(freqs) && left > 0; s++ {
+		f := freqs[s]
+		w.WriteBits(uint64(f), uint(bits.Len32(left)))
+		left -= f
+		if f != 0 {
+			continue
+		}
+		run := 0
+		for s+1 < len(freqs) && freqs[s+1] == 0 {
+			run++
+			s++
+		}
+		for ; run >= 3; run -= 3 {
+			w.WriteBits(3, 2)
+		}
+		w.WriteBits(uint64(run), 2)
+	}
+	// Errors are sticky, so this reports any from the writes above.
+	return w.WriteBits(0, 0)
+}
+
+// ReadCounts reads the frequencies of symbols 0 to symbols-1 written by WriteCounts from r,
+// and returns them with their precision.
+func ReadCounts(r *bitio.BitReader, symbols int) ([]uint32, uint, error) {
+	v, err := r.ReadBits(5)
+	if err != nil {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	precision := uint(v)
+	if precision < MinPrecision || precision > MaxPrecision {
+		return nil, 0, errPrecision
+	}
+	corrupt := errors.New("ans: corrupt frequencies")
+	freqs := make([]uint32, symbols)
+	left := uint32(1) << precision
+	for s := 0; left > 0; s++ {
+		if s >= symbols {
+			return nil, 0, corrupt
+		}
+		v, err = r.ReadBits(uint(bits.Len32(left)))
+		if err != nil {
+			return nil, 0, io.ErrUnexpectedEOF
+		}
+		if uint32(v) > left {
+			return nil, 0, corrupt
+		}
+		freqs[s] = uint32(v)
+		left -= uint32(v)
+		if v != 0 {
+			continue
+		}
+		for {
+			v, err = r.ReadBits(2)
+			if err != nil {
+				return nil, 0, io.ErrUnexpectedEOF
+			}
+			s += int(v)
+			if v < 3 {
+				break
+			}
+		}
+	}
+	return freqs, precision, nil
+}
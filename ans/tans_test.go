@@ -0,0 +1,109 @@
+package ans
+
+import (
+	"bytes"
+	bitio "compression/bitio"
+	"testing"
+)
+
+// Data coded with tANS at every precision, with the frequencies written out and read back
+// first, decodes again, and codes to no more than rANS does with the same frequencies.
+func TestFSE(t *testing.T) {
+	data, counts := testData(50000, 1)
+	for precision := uint(MinPrecision); precision <= MaxPrecision; precision++ {
+		freqs, err := Normalize(counts, precision)
+		if err != nil {
+			t.Fatal(err)
+		}
+		table, err := NewFSE(freqs, precision)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		w := bitio.NewBitWriter(&buf, bitio.MSB)
+		if err := WriteCounts(w, freqs, precision); err != nil {
+			t.Fatal(err)
+		}
+		header := w.BitsWritten()
+		if err := table.Encode(w, data); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+
+		in := bitio.NewBitReaderBytes(buf.Bytes(), bitio.MSB)
+		read, p, err := ReadCounts(in, 256)
+		if err != nil || p != precision {
+			t.Fatalf("precision %d: read precision %d, %v", precision, p, err)
+		}
+		for s := range freqs {
+			if read[s] != freqs[s] {
+				t.Fatalf("precision %d: symbol %d has frequency %d, want %d", precision, s, read[s], freqs[s])
+			}
+		}
+		if in.BitsRead() != header {
+			t.Errorf("precision %d: read %d bits of frequencies, wrote %d", precision, in.BitsRead(), header)
+		}
+		out := make([]byte, len(data))
+		if err := table.Decode(in, out); err != nil || !bytes.Equal(out, data) {
+			t.Errorf("precision %d: decoded data does not match, %v", precision, err)
+		}
+
+		rans, _ := NewTable(freqs, precision)
+		coded, _ := rans.Encode(data)
+		size := (8*int64(buf.Len()) - header) / 8
+		if size > int64(len(coded))+int64(len(coded))/200 {
+			t.Errorf("precision %d: %d bytes, rANS takes %d", precision, size, len(coded))
+		}
+	}
+}
+
+func TestBadCounts(t *testing.T) {
+	var buf bytes.Buffer
+	w := bitio.NewBitWriter(&buf, bitio.MSB)
+	if WriteCounts(w, []uint32{1 << 11, 1 << 11, 1}, MinPrecision) == nil {
+		t.Error("wrote frequencies that add up to too much")
+	}
+	w = bitio.NewBitWriter(&buf, bitio.MSB)
+	if WriteCounts(w, []uint32{1 << 11}, MinPrecision) == nil {
+		t.Error("wrote frequencies that add up to too little")
+	}
+	if WriteCounts(w, []uint32{1 << 20}, 20) == nil {
+		t.Error("wrote a precision that is too high")
+	}
+	// Every frequency but the last one is 0, so there are too many symbols.
+	buf.Reset()
+	w = bitio.NewBitWriter(&buf, bitio.MSB)
+	freqs := make([]uint32, 256)
+	freqs[255] = 1 << MinPrecision
+	WriteCounts(w, freqs, MinPrecision)
+	w.Flush()
+	if _, _, err := ReadCounts(bitio.NewBitReaderBytes(buf.Bytes(), bitio.MSB), 255); err == nil {
+		t.Error("read frequencies for more symbols than there are")
+	}
+}
+
+// Data coded with other frequencies or cut short does not decode.
+func TestFSECorrupt(t *testing.T) {
+	data, counts := testData(1000, 2)
+	freqs, _ := Normalize(counts, DefaultPrecision)
+	table, _ := NewFSE(freqs, DefaultPrecision)
+	var buf bytes.Buffer
+	w := bitio.NewBitWriter(&buf, bitio.MSB)
+	table.Encode(w, data)
+	w.Flush()
+	out := make([]byte, len(data))
+	if table.Decode(bitio.NewBitReaderBytes(buf.Bytes()[:buf.Len()/2], bitio.MSB), out) == nil {
+		t.Error("truncated data decoded")
+	}
+	uniform := make([]int, 256)
+	for s := range uniform {
+		uniform[s] = 1
+	}
+	freqs, _ = Normalize(uniform, DefaultPrecision)
+	other, _ := NewFSE(freqs, DefaultPrecision)
+	if other.Decode(bitio.NewBitReaderBytes(buf.Bytes(), bitio.MSB), out) == nil {
+		t.Error("decoded with other frequencies")
+	}
+}
@@ -0,0 +1,328 @@
+package bitio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Bit level reading and writing, shared by the codecs.
+//
+// Bits go through a 64 bit buffer. With MSB order the first bit of a stream is the top bit of
+// its first byte (like Huffman and arithmetic coding here, and bzip2), with LSB order it is the
+// bottom bit (like deflate). Values of n bits are written and read with their top bit first
+// in MSB order, and with their bottom bit first in LSB order, so ReadBits gives back what
+// WriteBits was given either way.
+
+// Order of the bits within a byte.
+type Order int
+
+const (
+	MSB Order = iota
+	LSB
+)
+
+// Most bits PeekBits can look at.
+const MaxPeek = 56
+
+var errOrder = errors.New("bitio: unknown bit order")
+
+// BitWriter writes bits to an io.Writer.
+// Errors are sticky: once a write fails, every later call returns the same error.
+type BitWriter struct {
+	w     io.Writer
+	order Order
+	buf   uint64
+	nbits uint
+	out   []byte
+	count int64 // bits written
+	err   error
+}
+
+const outSize = 4096
+
+// NewBitWriter returns a BitWriter that writes to w. Nothing reaches w before Flush, or before
+// a few KB have been written.
+func NewBitWriter(w io.Writer, order Order) *BitWriter {
+	z := &BitWriter{w: w, order: order, out: make([]byte, 0, outSize)}
+	if order != MSB && order != LSB {
+		z.err = errOrder
+	}
+	return z
+}
+
+// WriteBits writes the low n bits of v. n must be <= 64.
+func (z *BitWriter) WriteBits(v uint64, n uint) error {
+	if z.err != nil {
+		return z.err
+	}
+	if n > 32 {
+		// Keep room in the buffer for whole bytes, which are never more than 7 bits short.
+		if z.order == MSB {
+			z.WriteBits(v>>32, n-32)
+			return z.WriteBits(v, 32)
+		}
+		z.WriteBits(v, 32)
+		return z.WriteBits(v>>32, n-32)
+	}
+	if n == 0 {
+		return nil
+	}
+	v &= uint64(1)<<n - 1
+	if z.order == MSB {
+		z.buf |= v << (64 - z.nbits - n)
+	} else {
+		z.buf |= v << z.nbits
+	}
+	z.nbits += n
+	z.count += int64(n)
+	for z.nbits >= 8 {
+		if z.order == MSB {
+			z.out = append(z.out, byte(z.buf>>56))
+			z.buf <<= 8
+		} else {
+			z.out = append(z.out, byte(z.buf))
+			z.buf >>= 8
+		}
+		z.nbits -= 8
+	}
+	if len(z.out) >= outSize {
+		return z.writeOut()
+	}
+	return nil
+}
+
+// WriteBit writes a single bit, 0 or 1.
+func (z *BitWriter) WriteBit(bit uint8) error {
+	return z.WriteBits(uint64(bit), 1)
+}
+
+// Align writes zeros up to the next byte boundary, and returns how many it wrote.
+func (z *BitWriter) Align() (uint, error) {
+	pad := (8 - uint(z.count%8)) % 8
+	return pad, z.WriteBits(0, pad)
+}
+
+// Flush aligns to a byte boundary, and writes everything buffered to the underlying writer.
+func (z *BitWriter) Flush() error {
+	_, err := z.Align()
+	if err != nil {
+		return err
+	}
+	return z.writeOut()
+}
+
+func (z *BitWriter) writeOut() error {
+	if z.err != nil {
+		return z.err
+	}
+	_, z.err = z.w.Write(z.out)
+	z.out = z.out[:0]
+	return z.err
+}
+
+// BitsWritten is the number of bits written so far, including padding.
+func (z *BitWriter) BitsWritten() int64 {
+	return z.count
+}
+
+// BitReader reads bits from an io.Reader.
+// It only reads the bytes it needs, so whatever follows the bits can still be read from an
+// io.ByteReader afterwards. Other readers are wrapped in a bufio.Reader.
+type BitReader struct {
+	r     io.ByteReader
+	data  []byte // the input, for a reader from NewBitReaderBytes
+	pos   int
+	order Order
+	buf   uint64
+	nbits uint
+	eof   bool
+	count int64 // bits consumed
+	err   error
+}
+
+// NewBitReader returns a BitReader that reads from r.
+func NewBitReader(r io.Reader, order Order) *BitReader {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	z := &BitReader{r: br, order: order}
+	if order != MSB && order != LSB {
+		z.err = errOrder
+	}
+	return z
+}
+
+// NewBitReaderBytes returns a BitReader that reads from data. It is faster than NewBitReader,
+// as it can load 8 bytes at a time.
+func NewBitReaderBytes(data []byte, order Order) *BitReader {
+	z := &BitReader{data: data, order: order}
+	if order != MSB && order != LSB {
+		z.err = errOrder
+	}
+	return z
+}
+
+// Get at least n bits into the buffer, or as many as are left.
+func (z *BitReader) fill(n uint) error {
+	if z.r == nil {
+		z.fillBytes(n)
+		return nil
+	}
+	for z.nbits < n && !z.eof {
+		b, err := z.r.ReadByte()
+		if err == io.EOF {
+			z.eof = true
+			break
+		}
+		if err != nil {
+			z.err = err
+			return err
+		}
+		if z.order == MSB {
+			z.buf |= uint64(b) << (56 - z.nbits)
+		} else {
+			z.buf |= uint64(b) << z.nbits
+		}
+		z.nbits += 8
+	}
+	return nil
+}
+
+// fill for a reader over a slice. While 8 bytes are left, it loads them at once and keeps as many
+// whole bytes as fit in the buffer.
+func (z *BitReader) fillBytes(n uint) {
+	if z.pos+8 <= len(z.data) {
+		k := (64 - z.nbits) / 8
+		if z.order == MSB {
+			v := binary.BigEndian.Uint64(z.data[z.pos:])
+			z.buf |= v >> (64 - 8*k) << (64 - 8*k) >> z.nbits
+		} else {
+			v := binary.LittleEndian.Uint64(z.data[z.pos:])
+			z.buf |= v << (64 - 8*k) >> (64 - 8*k) << z.nbits
+		}
+		z.pos += int(k)
+		z.nbits += 8 * k
+		return
+	}
+	for z.nbits < n && z.pos < len(z.data) {
+		if z.order == MSB {
+			z.buf |= uint64(z.data[z.pos]) << (56 - z.nbits)
+		} else {
+			z.buf |= uint64(z.data[z.pos]) << z.nbits
+		}
+		z.pos++
+		z.nbits += 8
+	}
+}
+
+// PeekBits returns the next n bits without consuming them. n must be <= MaxPeek.
+// Past the end of the input the bits are zeros; use Skip or ReadBits to find out if they exist.
+func (z *BitReader) PeekBits(n uint) (uint64, error) {
+	if z.err != nil {
+		return 0, z.err
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	if z.nbits < n {
+		err := z.fill(n)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if z.order == MSB {
+		return z.buf >> (64 - n), nil
+	}
+	return z.buf & (uint64(1)<<n - 1), nil
+}
+
+// Skip consumes n bits. n must be <= MaxPeek.
+// It returns io.ErrUnexpectedEOF if fewer than n bits are left, and consumes the rest.
+func (z *BitReader) Skip(n uint) error {
+	if z.err != nil {
+		return z.err
+	}
+	if z.nbits < n {
+		err := z.fill(n)
+		if err != nil {
+			return err
+		}
+	}
+	if z.nbits < n {
+		z.count += int64(z.nbits)
+		z.buf = 0
+		z.nbits = 0
+		return io.ErrUnexpectedEOF
+	}
+	if z.order == MSB {
+		z.buf <<= n
+	} else {
+		z.buf >>= n
+	}
+	z.nbits -= n
+	z.count += int64(n)
+	return nil
+}
+
+// ReadBits reads n bits. n must be <= 64.
+// It returns io.EOF if no bits are left, and io.ErrUnexpectedEOF if fewer than n are.
+func (z *BitReader) ReadBits(n uint) (uint64, error) {
+	if n > MaxPeek {
+		if z.order == MSB {
+			hi, err := z.ReadBits(n - 32)
+			if err != nil {
+				return 0, err
+			}
+			lo, err := z.ReadBits(32)
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return hi<<32 | lo, err
+		}
+		lo, err := z.ReadBits(32)
+		if err != nil {
+			return 0, err
+		}
+		hi, err := z.ReadBits(n - 32)
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return hi<<32 | lo, err
+	}
+	v, err := z.PeekBits(n)
+	if err != nil {
+		return 0, err
+	}
+	if n > 0 && z.nbits == 0 {
+		return 0, io.EOF
+	}
+	err = z.Skip(n)
+	if err != nil {
+		return 0, err
+	}
+	return v, nil
+}
+
+// ReadBit reads a single bit.
+func (z *BitReader) ReadBit() (uint8, error) {
+	v, err := z.ReadBits(1)
+	return uint8(v), err
+}
+
+// Align skips the bits up to the next byte boundary.
+func (z *BitReader) Align() error {
+	return z.Skip((8 - uint(z.count%8)) % 8)
+}
+
+// Order is the order the bits are read in.
+func (z *BitReader) Order() Order {
+	return z.order
+}
+
+// BitsRead is the number of bits consumed so far.
+func (z *BitReader) BitsRead() int64 {
+	return z.count
+}
@@ -0,0 +1,83 @@
+package bitio
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// Values of random widths, written and read back in both orders, from an io.Reader and a slice.
+func TestReadBits(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	widths := make([]uint, 5000)
+	values := make([]uint64, len(widths))
+	for i := range widths {
+		widths[i] = uint(r.Intn(65))
+		values[i] = r.Uint64() & (uint64(1)<<widths[i] - 1)
+	}
+	for _, order := range []Order{MSB, LSB} {
+		var buf bytes.Buffer
+		w := NewBitWriter(&buf, order)
+		for i, n := range widths {
+			w.WriteBits(values[i], n)
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		readers := map[string]*BitReader{
+			"reader": NewBitReader(bytes.NewReader(buf.Bytes()), order),
+			"bytes":  NewBitReaderBytes(buf.Bytes(), order),
+		}
+		for name, in := range readers {
+			for i, n := range widths {
+				v, err := in.ReadBits(n)
+				if err != nil || v != values[i] {
+					t.Fatalf("order %d, %s: value %d is %x, %v, want %x", order, name, i, v, err, values[i])
+				}
+			}
+			if err := in.Align(); err != nil {
+				t.Errorf("order %d, %s: %v", order, name, err)
+			}
+			if in.BitsRead() != int64(8*buf.Len()) {
+				t.Errorf("order %d, %s: read %d bits of %d", order, name, in.BitsRead(), 8*buf.Len())
+			}
+			if _, err := in.ReadBits(1); err != io.EOF {
+				t.Errorf("order %d, %s: %v at the end", order, name, err)
+			}
+		}
+	}
+}
+
+func TestShortRead(t *testing.T) {
+	for _, in := range []*BitReader{NewBitReader(bytes.NewReader([]byte{0xff}), MSB), NewBitReaderBytes([]byte{0xff}, MSB)} {
+		if _, err := in.ReadBits(12); err != io.ErrUnexpectedEOF {
+			t.Errorf("%v, want %v", err, io.ErrUnexpectedEOF)
+		}
+	}
+}
+
+func BenchmarkReadBits(b *testing.B) {
+	data := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+	for _, bytesReader := range []bool{false, true} {
+		name := "reader"
+		if bytesReader {
+			name = "bytes"
+		}
+		b.Run(name, func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				in := NewBitReader(bytes.NewReader(data), MSB)
+				if bytesReader {
+					in = NewBitReaderBytes(data, MSB)
+				}
+				for n := uint(1); ; n = n%13 + 1 {
+					if _, err := in.ReadBits(n); err != nil {
+						break
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package counter
+
+import (
+	ops "compression/ops"
+	"fmt"
+)
+
+// Order-N context model with bit counters, an ops.Predictor.
+//
+// The context of a bit is the previous N whole bytes plus the bits of the current byte seen so
+// far. Every context has a count of 0s and 1s in a hash table of 2^bits entries, and the
+// probability of a 1 is the KT estimate (n1 + 1/2) / (n0 + n1 + 1).
+// Contexts that hash to the same entry share counts, nothing checks for it.
+// When a count reaches countLimit both counts are halved, so the model keeps up with changes in the data.
+
+// Longest context, in bytes.
+const MaxOrder = 8
+
+// Largest table is 2^MaxBits entries.
+const MaxBits = 30
+
+const countLimit = 255
+
+// Model is an order-N counter model.
+type Model struct {
+	order  int
+	hist   uint64 // previous bytes, the most recent in the low byte
+	prefix uint32 // bits of the current byte seen so far, after a leading 1
+	counts [][2]uint8
+	shift  uint
+	i      int // entry for the current context
+}
+
+// New returns a Model using the previous order bytes as context, with a table of 2^bits entries.
+func New(order int, bits int) (*Model, error) {
+	if order < 0 || order > MaxOrder {
+		return nil, fmt.Errorf("counter: order must be between 0 and %d", MaxOrder)
+	}
+	if bits < 1 || bits > MaxBits {
+		return nil, fmt.Errorf("counter: bits must be between 1 and %d", MaxBits)
+	}
+	m := &Model{order: order, prefix: 1, counts: make([][2]uint8, 1<<bits), shift: uint(64 - bits)}
+	m.index()
+	return m, nil
+}
+
+// Find the entry for the current context.
+func (m *Model) index() {
+	ctx := m.hist
+	if m.order < 8 {
+		ctx &= uint64(1)<<(8*m.order) - 1
+	}
+	h := (ctx*0x9e3779b97f4a7c15 ^ uint64(m.prefix)) * 0xff51afd7ed558ccd
+	h ^= h >> 29
+	h *= 0xc4ceb9fe1a85ec53
+	m.i = int(h >> m.shift)
+}
+
+// P1 is the probability that the next bit is 1 (see ops.ProbBits).
+func (m *Model) P1() uint16 {
+	n0 := uint64(m.counts[m.i][0])
+	n1 := uint64(m.counts[m.i][1])
+	p := ((2*n1 + 1) << ops.ProbBits) / (2*(n0+n1) + 2)
+	if p < 1 {
+		p = 1
+	}
+	if p > 1<<ops.ProbBits-1 {
+		p = 1<<ops.ProbBits - 1
+	}
+	return uint16(p)
+}
+
+// Update counts bit in the current context and moves on to the next one.
+func (m *Model) Update(bit uint8) {
+	c := &m.counts[m.i]
+	c[bit]++
+	if c[bit] == countLimit {
+		c[0] >>= 1
+		c[1] >>= 1
+	}
+	m.prefix = m.prefix<<1 | uint32(bit)
+	if m.prefix > 0xff {
+		m.hist = m.hist<<8 | uint64(m.prefix&0xff)
+		m.prefix = 1
+	}
+	m.index()
+}
@@ -0,0 +1,69 @@
+package counter
+
+import (
+	"bytes"
+	ops "compression/ops"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// n bytes of made up English text, with words picked from a Zipf distribution.
+func testText(seed int64, n int) []byte {
+	r := rand.New(rand.NewSource(seed))
+	words := strings.Fields(`the of and to in a is that for it as was with be by on not he I this are
+		or his from at which but have an they you were her she there one all we their been has who
+		more would will if no when what so out up into can 1987 said about other than time only
+		these two may first then do any like my now over such our man me even most made after also`)
+	zipf := rand.NewZipf(r, 1.1, 2, uint64(len(words)-1))
+	var b bytes.Buffer
+	for b.Len() < n {
+		for i := r.Intn(15) + 3; i > 0; i-- {
+			b.WriteString(words[zipf.Uint64()])
+			b.WriteByte(' ')
+		}
+		b.WriteString([]string{". ", ", ", "?\n", ".\n\n"}[r.Intn(4)])
+	}
+	return b.Bytes()[:n]
+}
+
+func TestRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	random := make([]byte, 20000)
+	r.Read(random)
+	inputs := map[string][]byte{"empty": {}, "random": random, "text": testText(1, 50000)}
+	for name, data := range inputs {
+		for _, order := range []int{0, 1, 2, 4, MaxOrder} {
+			// A table of 2^4 entries makes most contexts share counts.
+			for _, bits := range []int{4, 16, 22} {
+				m, err := New(order, bits)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var enc bytes.Buffer
+				n, err := ops.EncodeBytes(&enc, bytes.NewReader(data), m)
+				if err != nil || n != int64(len(data)) {
+					t.Fatalf("%s, order %d, bits %d: %d bytes, %v", name, order, bits, n, err)
+				}
+				m, _ = New(order, bits)
+				var dec bytes.Buffer
+				err = ops.DecodeBytes(&dec, bytes.NewReader(enc.Bytes()), m, n)
+				if err != nil || !bytes.Equal(dec.Bytes(), data) {
+					t.Errorf("%s, order %d, bits %d: decoded data does not match, %v", name, order, bits, err)
+				}
+				if name == "text" && enc.Len() >= len(data) {
+					t.Errorf("order %d, bits %d: text codes to %.3f bits per byte",
+						order, bits, float64(enc.Len()*8)/float64(len(data)))
+				}
+			}
+		}
+	}
+}
+
+func TestBadParameters(t *testing.T) {
+	for _, p := range [][2]int{{-1, 16}, {MaxOrder + 1, 16}, {2, 0}, {2, MaxBits + 1}} {
+		if _, err := New(p[0], p[1]); err == nil {
+			t.Errorf("order %d, bits %d: no error", p[0], p[1])
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package ctw
+
+import (
+	"math"
+	"math/big"
+)
+
+// Numeric backends for beta, the ratio every node keeps (see node).
+//
+//	BackendLog    beta holds log(ratio) as a float64. This is the default, it never runs out of range.
+//	BackendFloat  beta holds the ratio itself. After a few hundred bits at a node it can overflow
+//	              to +Inf or underflow to 0, and the node then uses only one of its estimates.
+//	BackendBig    big holds the ratio as a big.Float, whose exponent doesn't run out, at bigPrec bits.
+//	              It is slow and only meant for checking the others.
+//
+// Probabilities going into and coming out of a backend are float64 in every case.
+type Backend int
+
+const (
+	BackendLog Backend = iota
+	BackendFloat
+	BackendBig
+)
+
+const bigPrec = 128
+
+// Operations a backend does on beta.
+type number interface {
+	// Set up a node that hasn't seen any bits yet, which has a ratio of 1.
+	blank(n *node)
+	// Share of the node's own estimate in its weighted probability, given the log odds of the weight.
+	share(n *node, logit float64) float64
+	// Multiply the ratio by pe/pc.
+	mul(n *node, pe float64, pc float64)
+	// Set the ratio to exp(l).
+	setLog(n *node, l float64)
+}
+
+func newNumber(b Backend) number {
+	switch b {
+	case BackendFloat:
+		return floatNumber{}
+	case BackendBig:
+		return bigNumber{}
+	}
+	return logNumber{}
+}
+
+type logNumber struct{}
+
+func (logNumber) blank(n *node) {
+	n.beta = 0
+}
+
+// beta * weight/(1-weight), turned into the share of pe with a sigmoid so large betas don't overflow.
+func (logNumber) share(n *node, logit float64) float64 {
+	return 1 / (1 + math.Exp(-(n.beta + logit)))
+}
+
+func (logNumber) mul(n *node, pe float64, pc float64) {
+	n.beta += math.Log(pe) - math.Log(pc)
+}
+
+func (logNumber) setLog(n *node, l float64) {
+	n.beta = l
+}
+
+type floatNumber struct{}
+
+func (floatNumber) blank(n *node) {
+	n.beta = 1
+}
+
+func (floatNumber) share(n *node, logit float64) float64 {
+	if math.IsInf(n.beta, 1) {
+		return 1
+	}
+	r := n.beta * math.Exp(logit)
+	return r / (1 + r)
+}
+
+func (floatNumber) mul(n *node, pe float64, pc float64) {
+	n.beta *= pe / pc
+}
+
+func (floatNumber) setLog(n *node, l float64) {
+	n.beta = math.Exp(l)
+}
+
+type bigNumber struct{}
+
+// A nil big is a ratio of 1, so blank nodes can be copied without sharing a big.Float.
+func (bigNumber) blank(n *node) {
+	n.big = nil
+}
+
+func (bigNumber) share(n *node, logit float64) float64 {
+	if n.big == nil {
+		r := math.Exp(logit)
+		return r / (1 + r)
+	}
+	r := new(big.Float).SetPrec(bigPrec).Mul(n.big, big.NewFloat(math.Exp(logit)))
+	d := new(big.Float).SetPrec(bigPrec).Add(r, big.NewFloat(1))
+	s, _ := r.Quo(r, d).Float64()
+	return s
+}
+
+func (bigNumber) mul(n *node, pe float64, pc float64) {
+	if n.big == nil {
+		n.big = new(big.Float).SetPrec(bigPrec).SetInt64(1)
+	}
+	n.big.Mul(n.big, big.NewFloat(pe))
+	n.big.Quo(n.big, big.NewFloat(pc))
+}
+
+func (bigNumber) setLog(n *node, l float64) {
+	n.big = new(big.Float).SetPrec(bigPrec).SetFloat64(math.Exp(l))
+}
@@ -0,0 +1,48 @@
+package ctw
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// Every backend should give the same code length. BackendFloat only agrees while no ratio
+// has run out of range, so the sequences are short.
+func TestBackends(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	random := make([]uint8, 300)
+	skewed := make([]uint8, 300)
+	periodic := make([]uint8, 300)
+	for i := range random {
+		random[i] = uint8(r.Intn(2))
+		if r.Intn(8) == 0 {
+			skewed[i] = 1
+		}
+		periodic[i] = uint8(i % 3 / 2)
+	}
+	inputs := map[string][]uint8{"random": random, "skewed": skewed, "periodic": periodic}
+	options := []Options{
+		{Depth: 8},
+		{Depth: 12, Estimator: ZR{}},
+		{Depth: 8, Switching: true},
+		{Depth: 16, Bytes: true, HashBits: 10},
+	}
+	for name, bits := range inputs {
+		for i, opts := range options {
+			lengths := []float64{}
+			for _, b := range []Backend{BackendLog, BackendFloat, BackendBig} {
+				opts.Backend = b
+				m := newModel(opts)
+				for _, bit := range bits {
+					m.Update(bit)
+				}
+				lengths = append(lengths, m.bits)
+			}
+			for b, l := range lengths[1:] {
+				if math.Abs(l-lengths[0]) > 1e-6 {
+					t.Errorf("%s, options %d: backend %d gives %v bits, log gives %v", name, i, b+1, l, lengths[0])
+				}
+			}
+		}
+	}
+}
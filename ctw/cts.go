@@ -0,0 +1,31 @@
+package ctw
+
+import "math"
+
+// Context Tree Switching, from Veness, Ng, Hutter and Bowling, "Context Tree Switching" (2012).
+// https://arxiv.org/abs/1111.3182
+//
+// CTW mixes a node's own estimate with its children's with fixed weights, so once one of them
+// has done better for long enough the other can hardly catch up. CTS keeps two weights at every
+// node, w_a for the node's estimate and w_b for its children, and after every bit lets a small
+// part of each flow to the other one (a switching prior):
+//
+//	w_a = (1 - alpha) * w_a * P_e(x|s) + alpha * w_b * P_w(x|child)
+//	w_b = (1 - alpha) * w_b * P_w(x|child) + alpha * w_a * P_e(x|s)
+//
+// with alpha = 1/(n+2) after the node has seen n bits. The probability of the next bit is mixed
+// the same way as in CTW, with share w_a/(w_a+w_b) for the node's estimate.
+//
+// Only the ratio of the weights matters, so it is kept in beta, as w_a/w_b divided by the odds
+// of the prior weight for the node's depth (see weight.go). That way both models mix the same way.
+
+// Log of the new beta for a node after a bit, given the share s of pe before the update, the estimate pe
+// and the child's weighted probability pc of the bit, and the number of bits n the node had seen.
+func switchBeta(logit float64, s float64, pe float64, pc float64, n float64) float64 {
+	alpha := 1 / (n + 2)
+	a := s * pe
+	b := (1 - s) * pc
+	wa := (1-alpha)*a + alpha*b
+	wb := (1-alpha)*b + alpha*a
+	return math.Log(wa) - math.Log(wb) - logit
+}
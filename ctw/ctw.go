@@ -2,8 +2,11 @@ package ctw
 
 import (
 	"bufio"
-	// ops "compression/ops"
+	bitio "compression/bitio"
+	ops "compression/ops"
+	"encoding/binary"
 	"fmt"
+	"io"
 	"log"
 	"math"
 	"math/big"
@@ -37,20 +40,152 @@ import (
 // Each node in context tree T_D has a binary string with length <= D.
 // Nodes with length == D are leaf nodes.
 
+// Depth used by Encode. Files written with any depth can be decoded.
 var Depth = 3
-var window = uint8(0)
-var mu = math.Pow(2, 63) / (math.Pow(2, 63) + 1)
 
+// Longest context that fits in the window.
+const MaxDepth = 64
+
+// Options for the encoder.
+type Options struct {
+	// Number of previous bits used as context, up to MaxDepth.
+	Depth int
+	// Most nodes the tree may grow to, 0 for no limit (see tree.go).
+	MaxNodes int
+	// Keep nodes in a hash table of 2^HashBits nodes instead of a tree, up to MaxHashBits.
+	// 0 uses a tree. MaxNodes is ignored.
+	HashBits int
+	// Model whole bytes instead of a stream of bits (see below). Depth should be a multiple of 8.
+	Bytes bool
+	// Estimator for the probability of a bit in a context (see estimator.go). nil uses KT.
+	Estimator Estimator
+	// Weight of a node's own estimate at each depth, from the root down (see weight.go).
+	// The last one is used for all deeper nodes, and nil uses 1/2 everywhere.
+	Weights []float64
+	// Step size for learning the weights while coding, 0 keeps them fixed.
+	LearnRate float64
+	// Only code the first MaxBytes bytes of the input, 0 codes all of it.
+	MaxBytes int
+	// Use Context Tree Switching (see cts.go) instead of weighting.
+	Switching bool
+	// How beta is stored (see backend.go).
+	Backend Backend
+}
+
+// Byte model, from Tjalkens, Volf and Willems, "Context-tree weighting method for text generating sources".
+// Every byte is coded as 8 binary decisions, MSB first, down the binary tree of byte values.
+// Each of the 255 internal nodes of that tree gets its own context tree, so the statistics for
+// the first bit of a byte are never mixed with those for the fifth. The context is made of
+// previous whole bytes only, the bits of the current byte seen so far pick the context tree.
+
+// A context tree and the window of previous bits it is conditioned on.
+// The most recent bit is the lowest bit of window.
+// In a byte model, window only holds whole bytes.
+type model struct {
+	depth     int
+	window    uint64
+	nodes     nodeStore
+	path      []*node     // nodes for the current window, from the root down
+	walked    bool        // path is up to date
+	trees     []nodeStore // one per node of the byte tree, nil unless Options.Bytes is set
+	prefix    int         // bits of the current byte seen so far, after a leading 1
+	est       Estimator
+	logits    []float64 // log odds of the weight at each depth
+	rate      float64
+	switching bool
+	num       number
+	bits      float64 // ideal code length of everything seen so far
+}
+
+// NewPredictor returns the model described by opts, for use with ops.EncodeBytes and ops.DecodeBytes.
+func NewPredictor(opts Options) ops.Predictor {
+	checkOptions(opts)
+	return newModel(opts)
+}
+
+func newModel(opts Options) *model {
+	m := &model{depth: opts.Depth, path: make([]*node, 0, opts.Depth+1), est: opts.Estimator}
+	m.logits = weightLogits(opts.Weights, opts.Depth)
+	m.rate = opts.LearnRate
+	m.switching = opts.Switching
+	m.num = newNumber(opts.Backend)
+	var blank node
+	m.num.blank(&blank)
+	if m.est == nil {
+		m.est = KT{}
+	}
+	count := 0
+	if !opts.Bytes {
+		if opts.HashBits > 0 {
+			m.nodes = newNodeTable(opts.HashBits, blank)
+		} else {
+			m.nodes = newNodeTree(opts.MaxNodes, &count, blank)
+		}
+		return m
+	}
+	m.trees = make([]nodeStore, 255)
+	for i := range m.trees {
+		if opts.HashBits > 0 {
+			m.trees[i] = newNodeTable(opts.HashBits-8, blank)
+		} else {
+			m.trees[i] = newNodeTree(opts.MaxNodes, &count, blank)
+		}
+	}
+	m.prefix = 1
+	m.nodes = m.trees[0]
+	return m
+}
+
+// Nodes don't store the probability of the whole sequence, which gets too small for float64
+// after a few hundred bits. Instead they store the ratio
+//
+//	beta = P_e / (P_w(left) * P_w(right))
+//
+// between the node's own estimate and the estimate of its children, by default as its log,
+// which stays in range (see backend.go).
+// The weighted probability of the next bit follows from it directly:
+//
+//	P_w(x|s) = (beta * P_e(x|s) + P_w(x|child)) / (beta + 1)
+//
+// where child is the child picked by the context. beta only changes on the context path:
+//
+//	beta *= P_e(x|s) / P_w(x|child)
 type node struct {
-	code  uint8
-	left  *node   //adds 1 to code
-	right *node   //adds 0 to code
-	c0    float64 //count of 0s
-	c1    float64 //count of 1s
-	d     int     //depth
-	p     float64 //weighted probability of a sequence with c0 "0"s and c1 "1"s
-	kt    float64 // Krichevsky–Trofimov estimate for p(x=0)
-} // In practice, probably don't need kt0 or kt1, but I have them there for now so I can graph them.
+	code  uint64     //last d bits of the context
+	left  *node      //adds 1 to code
+	right *node      //adds 0 to code
+	c0    float64    //count of 0s
+	c1    float64    //count of 1s
+	d     int        //depth
+	beta  float64    //log of P_e / (P_w(left) * P_w(right)), or the ratio itself for BackendFloat
+	big   *big.Float //the ratio for BackendBig
+}
+
+// File format, in byte order:
+//
+//	magic    [4]byte    "CTWZ"
+//	version  uint8
+//	depth    uint8
+//	hashBits uint8      0 for a tree
+//	flags    uint8      flagBytes, flagSwitching
+//	est      uint8      estimator, see estimatorID
+//	param    float64    parameter of the estimator (alpha for AlphaKT)
+//	maxNodes uint64     0 for no limit
+//	length   uint64     number of bytes coded
+//	rate     float64    learn rate of the weights
+//	backend  uint8
+//	weights  uint8      number of weights
+//	         []float64  the weights
+//	data     []byte     arithmetic coded bits (see ops.ArithEncoder)
+var magic = []byte("CTWZ")
+
+const version = 7
+
+const (
+	flagBytes     = 1
+	flagSwitching = 2
+)
+const headerLen = 4 + 1 + 1 + 1 + 1 + 1 + 8 + 8 + 8 + 8 + 1 + 1
 
 // Error Check
 func check(err error) {
@@ -60,71 +195,98 @@ func check(err error) {
 }
 
 // pop off oldest bit in window, add a new bit from source data
-func updateWin(bit uint8) {
-	window <<= 1
-	window |= bit
+// A byte model adds the bit to the current byte instead, and moves on to the tree for the new prefix.
+func (m *model) updateWin(bit uint8) {
+	if m.trees != nil {
+		m.prefix = m.prefix<<1 | int(bit)
+		if m.prefix > 0xff {
+			m.window = m.window<<8 | uint64(m.prefix&0xff)
+			m.prefix = 1
+		}
+		m.nodes = m.trees[m.prefix-1]
+		return
+	}
+	m.window <<= 1
+	m.window |= uint64(bit)
 }
 
-// Get 8 bits from a byte (bits are represented by bytes with either one or zero nonzero bits)
-func getBits(bt byte) []uint8 {
-	bits := make([]uint8, 8)
-	bits[7] = bt & uint8(1)
-	bits[6] = bt & uint8(2)
-	bits[5] = bt & uint8(4)
-	bits[4] = bt & uint8(8)
-	bits[3] = bt & uint8(16)
-	bits[2] = bt & uint8(32)
-	bits[1] = bt & uint8(64)
-	bits[0] = bt & uint8(128)
-	for i := range bits {
-		if bits[i] != uint8(0) {
-			bits[i] = uint8(1)
-		}
+// Estimate that the next bit is bit, given the counts in n.
+func (m *model) estimate(n *node, bit uint8) float64 {
+	return m.est.Prob(n.c0, n.c1, bit)
+}
+
+// Weighted probability of the next bit at node n at depth d, given the node's estimate pe and the
+// weighted probability pc of its child on the context path.
+func (m *model) mix(n *node, d int, pe float64, pc float64) float64 {
+	s := m.num.share(n, m.logits[d])
+	return s*pe + (1-s)*pc
+}
+
+// Find the nodes on the path for the current window, if that hasn't been done since the last update.
+func (m *model) walk() {
+	if !m.walked {
+		m.path = m.nodes.walk(m.path[:0], m.window, m.depth)
+		m.walked = true
 	}
-	return bits
 }
 
-func getBitsReverse(bt byte) []uint8 {
-	bits := make([]uint8, 8)
-	bits[0] = bt & uint8(1)
-	bits[1] = bt & uint8(2)
-	bits[2] = bt & uint8(4)
-	bits[3] = bt & uint8(8)
-	bits[4] = bt & uint8(16)
-	bits[5] = bt & uint8(32)
-	bits[6] = bt & uint8(64)
-	bits[7] = bt & uint8(128)
-	for i := range bits {
-		if bits[i] != uint8(0) {
-			bits[i] = uint8(1)
-		}
+// Weighted probability that the next bit is a 1, without changing any counts.
+// The last node on the path acts as a leaf. Working up from it, each node mixes its own
+// estimate with the weighted probability of its child.
+func (m *model) predictProb() float64 {
+	m.walk()
+	pw := m.estimate(m.path[len(m.path)-1], 1)
+	for i := len(m.path) - 2; i >= 0; i-- {
+		n := m.path[i]
+		pw = m.mix(n, i, m.estimate(n, 1), pw)
 	}
-	return bits
+	return pw
 }
 
-// Krichevsky–Trofimov estimator.
-// Recursively update probabilities of all nodes by calling this func on the root node.
-func updateProb(n *node, update uint8) {
-	if update&uint8(1) == 0 {
-		n.kt = n.kt * mu * (2*n.c0 + 1) / (2 * (n.c0 + n.c1 + float64(1)))
-		n.c0 += 1
-	} else {
-		n.kt *= mu * (2*n.c1 + 1) / (2 * (n.c0 + n.c1 + float64(1)))
-		n.c1 += 1
+// P1 is the conditional probability that the next bit is a 1, scaled for ops.ArithEncoder.
+func (m *model) P1() uint16 {
+	scaled := math.Round(m.predictProb() * (1 << ops.ProbBits))
+	if scaled < 1 {
+		scaled = 1
 	}
-	if n.d == Depth {
-		n.p = n.kt
-	} else {
-		bit := update & uint8(1)
-		newUpdate := update >> 1
+	if scaled > 1<<ops.ProbBits-1 {
+		scaled = 1<<ops.ProbBits - 1
+	}
+	return uint16(scaled)
+}
+
+// Update all nodes on the path with bit and add it to the window.
+// Adds the code length of bit according to the model to m.bits.
+func (m *model) Update(bit uint8) {
+	m.walk()
+	var pw float64
+	for i := len(m.path) - 1; i >= 0; i-- {
+		n := m.path[i]
+		pe := m.estimate(n, bit)
+		if i == len(m.path)-1 {
+			pw = pe
+		} else {
+			pc := pw
+			s := m.num.share(n, m.logits[i])
+			pw = s*pe + (1-s)*pc
+			if m.switching {
+				m.num.setLog(n, switchBeta(m.logits[i], s, pe, pc, n.c0+n.c1))
+			} else {
+				m.num.mul(n, pe, pc)
+			}
+			if m.rate > 0 {
+				learnWeight(&m.logits[i], m.rate, s, pe, pc, pw)
+			}
+		}
 		if bit == 0 {
-			updateProb(n.right, newUpdate)
+			n.c0 += 1
 		} else {
-			updateProb(n.left, newUpdate)
+			n.c1 += 1
 		}
-		weight := 0.5
-		n.p = weight*n.kt + (1-weight)*n.left.p*n.right.p
 	}
+	m.bits -= math.Log2(pw)
+	m.updateWin(bit)
+	m.walked = false
 }
 
 // func updateProbD(n *node, update uint8, a *float64, b *float64) uint8 {
@@ -173,296 +335,181 @@ func updateProb(n *node, update uint8) {
 // 	}
 // }
 
-// All probabilities should be initialized to 1.
-func initializeNodes(d int, code uint8) *node {
-	newNode := node{code: code, c0: float64(0), c1: float64(0), d: d, p: float64(1), kt: float64(1)}
-	if d < Depth {
-		rcode := code << 1
-		lcode := rcode | uint8(1)
-		newNode.left = initializeNodes(d+1, lcode)
-		newNode.right = initializeNodes(d+1, rcode)
+// Open the input file, and get the number of bytes to code from it: all of them, or the
+// first maxBytes when that is set.
+func openInput(fp string, maxBytes int) (*os.File, *bufio.Reader, int64) {
+	infile, err := os.Open(fp)
+	check(err)
+	info, err := infile.Stat()
+	check(err)
+	length := info.Size()
+	if maxBytes > 0 && length > int64(maxBytes) {
+		length = int64(maxBytes)
 	}
-	return &newNode
+	return infile, bufio.NewReader(io.LimitReader(infile, length)), length
 }
 
-// PROBLEM: PROBABILITIES ARE TOO SMALL TO REPRESENT WITH FLOAT64. NEED TO MANUALLY WRITE THEM INTO BYTES
-// POSSIBLE SOLUTION: USE ASSYMETRIC NUMBER SYSTEMS ENCODING https://en.wikipedia.org/wiki/Asymmetric_numeral_systems
-func Encode(fp string, op string) {
-	bytes, err := os.ReadFile(fp)
-	if err != nil {
-		log.Fatal(err)
+func checkOptions(opts Options) {
+	if opts.Depth < 0 || opts.Depth > MaxDepth {
+		log.Fatalf("ctw: depth must be between 0 and %d", MaxDepth)
 	}
-
-	desiredLength := 1000
-	if len(bytes) > desiredLength {
-		bytes = bytes[:desiredLength]
+	if opts.HashBits < 0 || opts.HashBits > MaxHashBits {
+		log.Fatalf("ctw: hash bits must be between 0 and %d", MaxHashBits)
 	}
+	if opts.Bytes && opts.HashBits > 0 && opts.HashBits < 9 {
+		log.Fatal("ctw: a byte model needs at least 9 hash bits")
+	}
+	if opts.MaxBytes < 0 {
+		log.Fatal("ctw: max bytes must not be negative")
+	}
+	if opts.MaxNodes < 0 {
+		log.Fatal("ctw: max nodes must not be negative")
+	}
+	checkWeights(opts)
+	if opts.Backend < BackendLog || opts.Backend > BackendBig {
+		log.Fatal("ctw: unknown backend")
+	}
+}
 
-	length := len(bytes)
-	llength := length / 20
-	fmt.Println("Bytes: ", length)
-
-	// B( empty_sequence | window) := 0 , where B(x) = # of bits needed to encode x
-	// B is related to interval for window
-	// I'm guessing its needed for decoding
-	lowerBound := float64(0)
-	upperBound := float64(1)
+// Encode compresses the file at fp with the context tree and an arithmetic coder, and writes the result to op.
+func Encode(fp string, op string) {
+	EncodeOptions(fp, op, Options{Depth: Depth})
+}
 
-	// Initialize nodes and do a dummy update on a "0" bit
-	root := initializeNodes(0, uint8(0))
-	updateProb(root, uint8(0))
+// EncodeOptions is Encode with the given options.
+func EncodeOptions(fp string, op string, opts Options) {
+	checkOptions(opts)
+	infile, r, length := openInput(fp, opts.MaxBytes)
+	defer infile.Close()
+	fmt.Println("Bytes: ", length)
 
-	probsfile, err := os.Create("probs.txt")
+	outfile, err := os.Create(op)
 	check(err)
-	w := bufio.NewWriter(probsfile)
-
-	ktprobsfile, err := os.Create("ktprobs.txt")
+	defer outfile.Close()
+	w := bufio.NewWriter(outfile)
+
+	header := make([]byte, headerLen)
+	copy(header, magic)
+	header[4] = version
+	header[5] = uint8(opts.Depth)
+	header[6] = uint8(opts.HashBits)
+	if opts.Bytes {
+		header[7] |= flagBytes
+	}
+	if opts.Switching {
+		header[7] |= flagSwitching
+	}
+	est, param := estimatorID(opts.Estimator)
+	header[8] = est
+	binary.BigEndian.PutUint64(header[9:], math.Float64bits(param))
+	binary.BigEndian.PutUint64(header[17:], uint64(opts.MaxNodes))
+	binary.BigEndian.PutUint64(header[25:], uint64(length))
+	binary.BigEndian.PutUint64(header[33:], math.Float64bits(opts.LearnRate))
+	header[41] = uint8(opts.Backend)
+	header[42] = uint8(len(opts.Weights))
+	for _, weight := range opts.Weights {
+		header = binary.BigEndian.AppendUint64(header, math.Float64bits(weight))
+	}
+	_, err = w.Write(header)
 	check(err)
-	w2 := bufio.NewWriter(ktprobsfile)
 
-	lbfile, err := os.Create("lb.txt")
+	// For every bit, get the probability that it is a 1 from the context tree given the
+	// previous Depth bits, code the bit with that probability, then update the tree.
+	m := newModel(opts)
+	n, err := ops.EncodeBytes(w, r, m)
 	check(err)
-	w3 := bufio.NewWriter(lbfile)
+	if n != length {
+		log.Fatal("ctw: input changed while it was read")
+	}
+	check(w.Flush())
 
-	bdfile, err := os.Create("bytedata.txt")
+	info, err := outfile.Stat()
 	check(err)
-	w4 := bufio.NewWriter(bdfile)
-
-	for i, bt := range bytes {
-		bits := getBits(bt)
-		for _, bit := range bits {
-			fmt.Fprintln(w, root.p)
-			fmt.Fprintln(w2, upperBound)
-			fmt.Fprintln(w3, lowerBound)
-			fmt.Fprintln(w4, big.NewInt(int64(bit)))
-
-			updateWin(bit)
-			updateProb(root, window)
-			if bit == 0 {
-				//lowerBound = logaddexp(lowerBound, root.p*logaddexp(upperBound, lowerBound+math.Log(-1)))
-				lowerBound += root.p
-			} else if bit == 1 {
-				//upperBound = logaddexp(upperBound, math.Log(-1)+root.p*logaddexp(upperBound, lowerBound+math.Log(-1)))
-				upperBound -= root.p
-
-			}
-			if i < 10 {
-				fmt.Println(lowerBound, " | ", upperBound)
-			}
-		}
-		if i%llength == 0 {
-			cnt := 5 * i / llength
-			fmt.Println(cnt, "%")
-		}
-	}
-	fmt.Println(100, "%")
-	w.Flush()
-	w2.Flush()
-	w3.Flush()
-	w4.Flush()
-
-	// NOTE (8/20/22): Arithmetic encoding should return a SINGLE number representing the final probability value
-	// Should also return the first x bits of the source data, where x=Depth. This is the information needed to get the decoder started.
-	// Also need to return an INTERVAL of probabilities, not just one probability.
-
-	// The decoder will start with their own blank tree and will update it with the x bits given by the encoder from the source data.
-	// The decoder will then decode the next but as a 1 or a 0 depending on which option keeps the final interval given by the encoder inside the decoder's new window it is constructiong as it goes.
-
-	// Proof:
-	//
-	// Base Case:
-	//    Decoder knows the first D bits of the source data.
-	//    Decoder constructs a new tree and initializes on the first D bits exactly how encoder would.
-	//    Decoder knows the interval [i,j] (s.t. 0<=i<j<=1) that was the final result of the encoder's tree.
-	//    Decoder keeps track of its own interval which is initially [0,1]
-	//
-	// Induction:
-	//    Decoder gets P(x=0) from the root of its current tree and uses that probability to divide the current interval up into subintervals
-	//                                                    0.0                   1.0
-	//       Final interval returned by encoder:           |----[]---------------|
-	//       Current interval and subintervals of decoder: |-[  0  | 1 ]---------|
-	//    Decoder knows the next bit is a 0 because it is following in the footsteps of the encoder, and if the encoder ended up at that final interval, then it neccessarily must have chosen 0 at this interval.
-	//    Knowing next bit is 0, decoder updates tree accordingly.
-	//    If the interval containing the chosen option is equal to the encoder's final interval, decoding stops.
-	//
-	// By repeating inductive step, all bits will be decoded.
-
-	//os.WriteFile(op,root.p (converted to byte array),os.ModeDevice)
 	fmt.Println()
-	fmt.Printf("INTERVAL: [%v, %v)\n", lowerBound, upperBound) //float64(0).Add(lowerBound, root.p))
-
-	// binaryCode := ops.Binary_expansion(lowerBound, float64(0).Add(lowerBound, root.p), []uint8{})
-	// fmt.Println()
-	// fmt.Println(binaryCode, len(binaryCode))
-	// fmt.Println()
-	// ret, n := binaryToFloat(binaryCode)
-	// fmt.Println(ret, n)
-	// os.WriteFile(op, binaryCode, os.ModeDevice)
-
-	fmt.Println("!!!", root.c0+root.c1, root.left.c0+root.left.c1, root.right.c0+root.right.c1)
-
-	fmt.Println(root.p)
+	fmt.Println("Compressed Bytes: ", info.Size())
+	// Ideal code length of the whole sequence according to the model.
+	fmt.Println("Model Bits: ", m.bits)
 }
 
-// func binaryToFloat(bc []uint8) (*float64, *float64) {
-// 	// neighbors := float64(1)
-// 	// ret := float64(0)
-// 	// for i, x := range bc {
-// 	// 	neighbors- math.Log(neighbors, float64(10))
-// 	// 	if x == 1 {
-// 	// 		ret.Add(ret, float64(math.Pow(2, -1.0*float64(i))))
-// 	// 	}
-// 	// }
-// 	// return ret, neighbors
-// 	a := float64(0)
-// 	b := float64(1)
-// 	for i, x := range bc {
-// 		if x == 0 {
-// 			b.Add(b, float64(-1*(math.Pow(2, float64(-(i+1))))))
-// 		} else {
-// 			a.Add(a, float64(math.Pow(2, float64(-(i+1)))))
-// 		}
-// 	}
-// 	return a, b
-// }
-
-// func Decode(fp string, op string) {
-// 	window = uint8(0)
-// 	bytes, err := os.ReadFile(fp)
-// 	if err != nil {
-// 		log.Fatal(err)
-// 	}
-// 	lowerBound := float64(0)
-// 	// for i, b := range bytes {
-// 	// 	if b == 0 {
-// 	// 		bytes[i] = 1
-// 	// 	}
-// 	// 	if b == 1 {
-// 	// 		bytes[i] = 0
-// 	// 	}
-// 	// }
-// 	a, b := binaryToFloat(bytes)
-// 	a = float64(0.0223388672)
-// 	b = float64(0.0223388672)
-// 	fmt.Println(bytes, a, b)
-// 	// Initialize nodes and do a dummy update on a "0" bit
-// 	root := initializeNodes(0, uint8(0))
-// 	updateProb(root, uint8(0))
-// 	updateCount(root, uint8(0))
-
-// 	decfile, err := os.Create(op)
-// 	check(err)
-// 	w := bufio.NewWriter(decfile)
-
-// 	bitsfile, err := os.Create("bitsfile.txt")
-// 	check(err)
-// 	w2 := bufio.NewWriter(bitsfile)
-
-// 	decProbfile, err := os.Create("decprobs.txt")
-// 	check(err)
-// 	w3 := bufio.NewWriter(decProbfile)
-
-// 	counter := 0
-// 	for {
-// 		counter = counter + 1
-// 		if counter == 3 {
-// 			w.Flush()
-// 			w2.Flush()
-// 			w3.Flush()
-// 			os.Exit(0)
-// 		}
-// 		bits := byte(0)
-// 		for y := 0; y < 8; y++ {
-// 			bit := eval(lowerBound, root.p, a, b)
-// 			fmt.Fprintln(w2, bit)
-// 			fmt.Fprintln(w3, lowerBound, root.p)
-// 			if bit == 2 {
-// 				fmt.Println("EOF")
-// 				w.Flush()
-// 				w2.Flush()
-// 				os.Exit(0)
-// 			} else if bit == 1 {
-// 				bits = bits | uint8(1)
-// 				lowerBound.Add(lowerBound, root.p)
-// 			} else if bit == 3 {
-// 				fmt.Println("eval returned nobinary answer")
-// 				w.Flush()
-// 				w2.Flush()
-// 				os.Exit(1)
-// 			}
-// 			updateWin(bit)
-// 			updateProb(root, bit)
-// 			updateCount(root, window)
-// 			bits = bits << 1
-// 		}
-// 		fmt.Fprint(w, string(bits))
-
-// 		// I dont think I should have to scale the p values since p should decrease exponentially...
-
-// 	}
+// Decode reads a file written by Encode from fp and writes the original bytes to op.
+// The decoder starts with the same blank tree as the encoder, gets the same probability for
+// every bit from it, and uses that to read the bit back out of the arithmetic coded data.
+// Then it updates the tree with the bit, exactly like the encoder did.
+func Decode(fp string, op string) {
+	infile, err := os.Open(fp)
+	check(err)
+	defer infile.Close()
+	r := bufio.NewReader(infile)
 
-// 	fmt.Print(bytes, lowerBound, a, b)
-
-// 	// Probably don't need to convert binary back to float
-
-// 	// have a string of bits. 1 tells you its above 0.5, 0 means below 0.5
-// 	// loop thru tree updates, where you take root.p and then see what will happen if you choose a 1 or a 0:
-// 	// case 1: only one of the choices keeps you in the interval defined by the bit (either the top or bottom half)
-// 	//     Choose that bit for the decoding output.
-// 	//     Move to the next bit of the encoded interval.
-// 	//     Adjust sizes (either make next encoded interval be half the length of the previous one, or make root.p interval double)
-// 	//         - (whatever you do, will need a variable that is maintained throughout loops to keep track of how much scaling is needed, since it will always be an additional factor of 2)
-// 	// case 2: both choices are within the interval
-// 	//     You are done encoding
-// 	// case 3: the interval overlaps both choices
-// 	//     Do procedure from "special case" op.
-// 	//     Need to expand the half
-
-// 	// decodedData := []byte{}
-// 	// scaler := 1
-// 	// bitIndex := 0
-// 	// for {
-// 	// 	byter := make([]uint8, 8)
-// 	// 	for i := range byter {
-// 	// 		switch {
-// 	// 		case condition:
-
-// 	// 		}
-// 	// 		byter[i] = ...
-
-// 	// 	}
-// 	// }
+	header := make([]byte, headerLen)
+	_, err = io.ReadFull(r, header)
+	if err != nil || string(header[:4]) != string(magic) {
+		log.Fatal("ctw: not a ctw file")
+	}
+	if header[4] != version {
+		log.Fatalf("ctw: unsupported version %d", header[4])
+	}
+	maxNodes := binary.BigEndian.Uint64(header[17:])
+	if maxNodes > math.MaxInt32 || header[7]&^(flagBytes|flagSwitching) != 0 {
+		log.Fatal("ctw: corrupt header")
+	}
+	opts := Options{Depth: int(header[5]), HashBits: int(header[6]), MaxNodes: int(maxNodes)}
+	opts.Bytes = header[7]&flagBytes != 0
+	opts.Switching = header[7]&flagSwitching != 0
+	opts.Estimator = newEstimator(header[8], math.Float64frombits(binary.BigEndian.Uint64(header[9:])))
+	opts.LearnRate = math.Float64frombits(binary.BigEndian.Uint64(header[33:]))
+	opts.Backend = Backend(header[41])
+	weights := make([]byte, 8*int(header[42]))
+	_, err = io.ReadFull(r, weights)
+	if err != nil {
+		log.Fatal("ctw: corrupt header")
+	}
+	for i := 0; i < len(weights); i += 8 {
+		opts.Weights = append(opts.Weights, math.Float64frombits(binary.BigEndian.Uint64(weights[i:])))
+	}
+	checkOptions(opts)
+	length := binary.BigEndian.Uint64(header[25:])
+	if length > math.MaxInt64 {
+		log.Fatal("ctw: corrupt header")
+	}
 
-// }
+	outfile, err := os.Create(op)
+	check(err)
+	defer outfile.Close()
+	w := bufio.NewWriter(outfile)
 
-// func eval(l *float64, p *float64, a *float64, b *float64) uint8 {
-// 	h := float64(0)
-// 	h.Add(l, p)
-// 	ret := uint8(3)
-// 	// if l.Cmp(a) >= 0 { //&& h.Cmp(b) < 0
-// 	// 	// EOF
-// 	// 	ret = 2
-// 	// } else ...
-// 	if h.Cmp(b) >= 0 {
-// 		ret = 1
-// 	} else if h.Cmp(a) < 0 {
-// 		ret = 0
-// 	} else {
-// 		//fmt.Printf("p: %v | a: %v | b: %v \n", p, a, b)
-// 		ret = 1 //3
-// 	}
-// 	fmt.Printf("lo: %-20v | hi: %-20v | a: %-20v | b: %-20v \n bit: %-20v \n", l, h, a, b, ret)
-// 	return ret
+	check(ops.DecodeBytes(w, r, newModel(opts), int64(length)))
+	check(w.Flush())
+}
 
-// }
+// BitsPerByte runs the model over the file at fp without coding anything, and returns
+// the average number of bits per byte it would take to code it.
+func BitsPerByte(fp string, opts Options) float64 {
+	checkOptions(opts)
+	infile, r, length := openInput(fp, opts.MaxBytes)
+	defer infile.Close()
+	if length == 0 {
+		return 0
+	}
+	m := newModel(opts)
+	in := bitio.NewBitReader(r, bitio.MSB)
+	for {
+		bit, err := in.ReadBit()
+		if err == io.EOF {
+			break
+		}
+		check(err)
+		m.Update(bit)
+	}
+	return m.bits / float64(length)
+}
 
 //------------------------------------------
 //Bug Tests
 
 // Get path of leafnodes in huffman tree
 func recCheck(hufT *node, list []int) {
-	if hufT.d == Depth {
-		fmt.Println(&hufT, *hufT, list)
+	if hufT == nil {
 		return
 	}
 	fmt.Println(&hufT, *hufT, list)
@@ -0,0 +1,145 @@
+package ctw
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testOptions = []Options{
+	{Depth: Depth},
+	{Depth: 16, MaxNodes: 2000},
+	{Depth: 16, Bytes: true, HashBits: 12, Estimator: ZR{}},
+	{Depth: 8, Switching: true, Estimator: AlphaKT{Alpha: 1.0 / 16}},
+	{Depth: 12, Weights: []float64{0.5, 0.3}, LearnRate: 0.01},
+}
+
+// Text that looks like the start of enwik8: the XML of a wikipedia dump, with wiki markup in it.
+func wikiText(seed int64, n int) []byte {
+	r := rand.New(rand.NewSource(seed))
+	words := []string{"the", "of", "and", "in", "a", "to", "was", "is", "for", "as", "by", "with",
+		"anarchism", "political", "philosophy", "state", "society", "history", "movement", "century"}
+	var b bytes.Buffer
+	b.WriteString("<mediawiki xmlns=\"http://www.mediawiki.org/xml/export-0.3/\" version=\"0.3\" xml:lang=\"en\">\n")
+	for id := 1; b.Len() < n; id++ {
+		fmt.Fprintf(&b, "  <page>\n    <title>%s</title>\n    <id>%d</id>\n    <revision>\n", words[r.Intn(len(words))], id)
+		fmt.Fprintf(&b, "      <timestamp>2006-03-%02dT%02d:%02d:00Z</timestamp>\n", r.Intn(28)+1, r.Intn(24), r.Intn(60))
+		b.WriteString("      <text xml:space=\"preserve\">")
+		for i := r.Intn(200) + 20; i > 0; i-- {
+			switch w := words[r.Intn(len(words))]; r.Intn(12) {
+			case 0:
+				fmt.Fprintf(&b, "[[%s]] ", w)
+			case 1:
+				fmt.Fprintf(&b, "'''%s''' ", w)
+			case 2:
+				b.WriteString(w + ".\n\n")
+			default:
+				b.WriteString(w + " ")
+			}
+		}
+		b.WriteString("</text>\n    </revision>\n  </page>\n")
+	}
+	return b.Bytes()[:n]
+}
+
+// n bytes of made up English text, with words picked from a Zipf distribution.
+func testText(seed int64, n int) []byte {
+	r := rand.New(rand.NewSource(seed))
+	words := strings.Fields(`the of and to in a is that for it as was with be by on not he I this are
+		or his from at which but have an they you were her she there one all we their been has who
+		more would will if no when what so out up into can 1987 said about other than time only
+		these two may first then do any like my now over such our man me even most made after also`)
+	zipf := rand.NewZipf(r, 1.1, 2, uint64(len(words)-1))
+	var b bytes.Buffer
+	for b.Len() < n {
+		for i := r.Intn(15) + 3; i > 0; i-- {
+			b.WriteString(words[zipf.Uint64()])
+			b.WriteByte(' ')
+		}
+		b.WriteString([]string{". ", ", ", "?\n", ".\n\n"}[r.Intn(4)])
+	}
+	return b.Bytes()[:n]
+}
+
+// Inputs to round trip, small enough to code with every option quickly.
+func testInputs() map[string][]byte {
+	r := rand.New(rand.NewSource(1))
+	random := make([]byte, 2000)
+	r.Read(random)
+	return map[string][]byte{
+		"empty":  {},
+		"random": random,
+		"text":   testText(1, 8000),
+		"wiki":   wikiText(1, 8000),
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range testInputs() {
+		fp := filepath.Join(dir, name)
+		if err := os.WriteFile(fp, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		for i, opts := range testOptions {
+			EncodeOptions(fp, fp+".ctw", opts)
+			Decode(fp+".ctw", fp+".ctw.out")
+			dec, err := os.ReadFile(fp + ".ctw.out")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(dec, data) {
+				t.Errorf("options %d, %s: decoded data does not match", i, name)
+			}
+		}
+	}
+}
+
+// Text should code to fewer bits than random bytes.
+func TestCompresses(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range testInputs() {
+		if name == "empty" {
+			continue
+		}
+		fp := filepath.Join(dir, name)
+		if err := os.WriteFile(fp, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		bpb := BitsPerByte(fp, Options{Depth: 16})
+		if name == "random" && bpb < 7.9 {
+			t.Errorf("%s: %.3f bits per byte", name, bpb)
+		} else if name != "random" && bpb > 6 {
+			t.Errorf("%s: %.3f bits per byte", name, bpb)
+		}
+	}
+}
+
+// With MaxBytes, only the start of the input is coded.
+func TestMaxBytes(t *testing.T) {
+	dir := t.TempDir()
+	data := testText(2, 3000)
+	fp := filepath.Join(dir, "text")
+	if err := os.WriteFile(fp, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, max := range []int{1, 1000, len(data), 2 * len(data)} {
+		EncodeOptions(fp, fp+".ctw", Options{Depth: 16, MaxBytes: max})
+		Decode(fp+".ctw", fp+".ctw.out")
+		dec, err := os.ReadFile(fp + ".ctw.out")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := data
+		if max < len(data) {
+			want = data[:max]
+		}
+		if !bytes.Equal(dec, want) {
+			t.Errorf("max %d: decoded %d bytes, want the first %d", max, len(dec), len(want))
+		}
+	}
+}
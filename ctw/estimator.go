@@ -0,0 +1,111 @@
+package ctw
+
+import (
+	"log"
+	"math"
+)
+
+// Estimator gives the probability that the next bit in a context is bit, given the number of
+// 0s (c0) and 1s (c1) that followed the context so far.
+// Only the estimators in this file can be written to the file header.
+type Estimator interface {
+	Prob(c0 float64, c1 float64, bit uint8) float64
+}
+
+// KT is the Krichevsky–Trofimov estimator, which adds 1/2 to both counts.
+type KT struct{}
+
+func (KT) Prob(c0 float64, c1 float64, bit uint8) float64 {
+	if bit == 0 {
+		return (c0 + 0.5) / (c0 + c1 + 1)
+	}
+	return (c1 + 0.5) / (c0 + c1 + 1)
+}
+
+// AlphaKT adds Alpha to both counts instead of 1/2. A small Alpha (like 1/16) trusts the counts
+// more, which suits contexts that are nearly always followed by the same bit.
+type AlphaKT struct {
+	Alpha float64
+}
+
+func (e AlphaKT) Prob(c0 float64, c1 float64, bit uint8) float64 {
+	if bit == 0 {
+		return (c0 + e.Alpha) / (c0 + c1 + 2*e.Alpha)
+	}
+	return (c1 + e.Alpha) / (c0 + c1 + 2*e.Alpha)
+}
+
+// ZR is the zero-redundancy estimator from Willems, Shtarkov and Tjalkens, "Context weighting
+// for general finite-context sources". It gives half of the probability to KT and a quarter each
+// to the sequences of only 0s and only 1s:
+//
+//	P_zr(a, b) = P_kt(a, b)/2 + [b == 0]/4 + [a == 0]/4,  P_zr(0, 0) = 1
+//
+// so a context that has only ever been followed by one bit costs a bounded number of bits.
+type ZR struct{}
+
+// Log of the KT probability of a sequence of a 0s and b 1s.
+func logKT(a float64, b float64) float64 {
+	la, _ := math.Lgamma(a + 0.5)
+	lb, _ := math.Lgamma(b + 0.5)
+	lab, _ := math.Lgamma(a + b + 1)
+	return la + lb - lab - math.Log(math.Pi)
+}
+
+// Log of the zero-redundancy probability of a sequence of a 0s and b 1s.
+func logZR(a float64, b float64) float64 {
+	if a == 0 && b == 0 {
+		return 0
+	}
+	if a > 0 && b > 0 {
+		return logKT(a, b) - math.Ln2
+	}
+	return math.Log(math.Exp(logKT(a, b))/2 + 0.25)
+}
+
+func (ZR) Prob(c0 float64, c1 float64, bit uint8) float64 {
+	if bit == 0 {
+		return math.Exp(logZR(c0+1, c1) - logZR(c0, c1))
+	}
+	return math.Exp(logZR(c0, c1+1) - logZR(c0, c1))
+}
+
+// Estimator ids in the file header.
+const (
+	estimatorKT    = 0
+	estimatorZR    = 1
+	estimatorAlpha = 2
+)
+
+// Id and parameter of an estimator, for the file header.
+func estimatorID(e Estimator) (uint8, float64) {
+	switch e := e.(type) {
+	case nil, KT:
+		return estimatorKT, 0
+	case ZR:
+		return estimatorZR, 0
+	case AlphaKT:
+		if !(e.Alpha > 0) {
+			log.Fatal("ctw: alpha must be greater than 0")
+		}
+		return estimatorAlpha, e.Alpha
+	}
+	log.Fatalf("ctw: estimator %T can not be written to a file", e)
+	return 0, 0
+}
+
+func newEstimator(id uint8, param float64) Estimator {
+	switch id {
+	case estimatorKT:
+		return KT{}
+	case estimatorZR:
+		return ZR{}
+	case estimatorAlpha:
+		if !(param > 0) {
+			log.Fatal("ctw: corrupt header")
+		}
+		return AlphaKT{Alpha: param}
+	}
+	log.Fatalf("ctw: unknown estimator %d", id)
+	return nil
+}
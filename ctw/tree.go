@@ -0,0 +1,138 @@
+package ctw
+
+// Storage for context tree nodes.
+//
+// A full tree of depth D has 2^(D+1)-1 nodes, but only contexts that actually occur in the data
+// are ever visited, so nodes are created the first time their context is seen. A blank node
+// (no counts, beta of 0) predicts exactly what a missing one would, so this does not change
+// the probabilities.
+//
+// There are two stores:
+//
+//	nodeTree   nodes linked from the root, left for a 1 and right for a 0. With a node limit,
+//	           once the tree is full no more contexts are added, and the deepest node on the
+//	           path that exists acts as a leaf for that bit.
+//	nodeTable  a fixed size hash table, for deep models. Slots are grouped in buckets of two.
+//	           A context that is not in its bucket takes an empty slot, or else the slot with the
+//	           lower count (c0+c1), which is reset. Slots holding nodes higher up on the current
+//	           path are never taken. If both are, the path ends there like in a full nodeTree.
+//
+// A byte model (see Options.Bytes) has 255 stores. Its trees share one node limit, and its
+// hash table is split into 255 tables of 2^(HashBits-8) nodes.
+//
+// Encoder and decoder see the same contexts in the same order, so they evict the same nodes.
+
+// Anything that can find the nodes on a context path.
+type nodeStore interface {
+	// Append the nodes for the last 0, 1, ..., depth bits of window to path.
+	// Fewer than depth+1 nodes are appended when the store is full.
+	walk(path []*node, window uint64, depth int) []*node
+}
+
+// Last d bits of window.
+func contextBits(window uint64, d int) uint64 {
+	if d >= 64 {
+		return window
+	}
+	return window & (uint64(1)<<d - 1)
+}
+
+// New nodes are copies of blank (see number) with code and d set.
+type nodeTree struct {
+	root  *node
+	count *int // shared by the trees of a byte model
+	max   int  // 0 for no limit
+	blank node
+}
+
+func newNodeTree(max int, count *int, blank node) *nodeTree {
+	*count++
+	root := blank
+	return &nodeTree{root: &root, count: count, max: max, blank: blank}
+}
+
+func (t *nodeTree) walk(path []*node, window uint64, depth int) []*node {
+	n := t.root
+	path = append(path, n)
+	for d := 1; d <= depth; d++ {
+		bit := (window >> (d - 1)) & 1
+		child := &n.right
+		if bit == 1 {
+			child = &n.left
+		}
+		if *child == nil {
+			if t.max > 0 && *t.count >= t.max {
+				break
+			}
+			c := t.blank
+			c.code = n.code | bit<<(d-1)
+			c.d = d
+			*child = &c
+			*t.count++
+		}
+		n = *child
+		path = append(path, n)
+	}
+	return path
+}
+
+// Largest table is 2^MaxHashBits nodes.
+const MaxHashBits = 30
+
+type nodeTable struct {
+	root  node
+	slots []node
+	shift uint
+	blank node
+}
+
+func newNodeTable(bits int, blank node) *nodeTable {
+	t := &nodeTable{root: blank, slots: make([]node, 1<<bits), shift: uint(64 - bits), blank: blank}
+	for i := range t.slots {
+		t.slots[i] = blank
+		t.slots[i].d = -1
+	}
+	return t
+}
+
+// Index of the first slot of the bucket for a context.
+func (t *nodeTable) bucket(code uint64, d int) int {
+	h := (code ^ uint64(d)*0x9e3779b97f4a7c15) * 0xff51afd7ed558ccd
+	h ^= h >> 29
+	h *= 0xc4ceb9fe1a85ec53
+	return int(h>>t.shift) &^ 1
+}
+
+func (t *nodeTable) walk(path []*node, window uint64, depth int) []*node {
+	path = append(path, &t.root)
+	for d := 1; d <= depth; d++ {
+		code := contextBits(window, d)
+		i := t.bucket(code, d)
+		var n *node
+		var victim *node
+		for _, s := range []*node{&t.slots[i], &t.slots[i+1]} {
+			if s.d == d && s.code == code {
+				n = s
+				break
+			}
+			if s.d >= 0 && s.d < d && s.code == contextBits(window, s.d) {
+				// On the current path.
+				continue
+			}
+			if victim == nil || s.d < 0 || (victim.d >= 0 && s.c0+s.c1 < victim.c0+victim.c1) {
+				victim = s
+			}
+		}
+		if n == nil {
+			if victim == nil {
+				break
+			}
+			*victim = t.blank
+			victim.code = code
+			victim.d = d
+			n = victim
+		}
+		path = append(path, n)
+	}
+	return path
+}
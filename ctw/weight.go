@@ -0,0 +1,58 @@
+package ctw
+
+import (
+	"log"
+	"math"
+)
+
+// Weighting at internal nodes.
+//
+// The weighted probability at a node is
+//
+//	P_w = weight * P_e + (1 - weight) * P_w(left) * P_w(right)
+//
+// where weight is the prior probability that the model stops at the node. The paper uses 1/2
+// everywhere. Options.Weights sets it per depth, and Options.LearnRate lets each depth's weight
+// follow the data, by taking a gradient step on the code length of every bit coded.
+//
+// Weights are kept as log odds, log(weight/(1-weight)), which is what the backends add to log(beta).
+// A learned weight is no longer a fixed prior, so the result is only an approximation of CTW,
+// but encoder and decoder still make the same updates in the same order.
+
+// Largest number of entries in Options.Weights.
+const maxWeights = MaxDepth + 1
+
+func checkWeights(opts Options) {
+	if len(opts.Weights) > maxWeights {
+		log.Fatalf("ctw: at most %d weights", maxWeights)
+	}
+	for _, w := range opts.Weights {
+		if !(w > 0 && w < 1) {
+			log.Fatal("ctw: weights must be between 0 and 1")
+		}
+	}
+	if !(opts.LearnRate >= 0) || math.IsInf(opts.LearnRate, 1) {
+		log.Fatal("ctw: learn rate must not be negative")
+	}
+}
+
+// Log odds of the weight at every depth from 0 to depth.
+func weightLogits(weights []float64, depth int) []float64 {
+	logits := make([]float64, depth+1)
+	w := 0.5
+	for d := range logits {
+		if d < len(weights) {
+			w = weights[d]
+		}
+		logits[d] = math.Log(w / (1 - w))
+	}
+	return logits
+}
+
+// Move the log odds of the weight at a node so it would have given the bit that was coded
+// a higher probability. pw is the weighted probability of the bit, and s the share of pe in it.
+//
+//	d log(pw) / d logit = (pe - pc) * s * (1 - s) / pw
+func learnWeight(logit *float64, rate float64, s float64, pe float64, pc float64, pw float64) {
+	*logit += rate * (pe - pc) * s * (1 - s) / pw
+}
@@ -0,0 +1,209 @@
+package Huffman
+
+import (
+	bitio "compression/bitio"
+	"encoding/binary"
+	"io"
+)
+
+// Adaptive (one pass) huffman coding with the FGK algorithm.
+// https://en.wikipedia.org/wiki/Adaptive_Huffman_coding
+//
+// Encoder and decoder both start with a tree holding only the NYT ("not yet transmitted") node,
+// and update it the same way after every symbol, so no code table is stored.
+// A symbol seen for the first time is sent as the code for NYT followed by its 8 bits.
+//
+// Nodes are numbered so that weights never decrease as the number goes up, and siblings are
+// next to each other (sibling property). The root has the highest number. After coding a
+// symbol, every node on the path from its leaf to the root is swapped with the highest numbered
+// node of the same weight and then incremented, which keeps the sibling property.
+
+const nyt = 256
+const adaptiveNodes = 2*257 - 1
+const adaptiveRoot = adaptiveNodes - 1
+
+// Longest code of a symbol: a path through a tree of 257 leaves, and the 8 bits of a new symbol.
+const maxAdaptiveBits = nyt + 8
+
+// Positions in the tree are fixed, and a node's contents (weight, children, symbol) are swapped
+// between positions. Children of an internal node are always at child and child+1.
+type adaptiveTree struct {
+	weight [adaptiveNodes]int
+	parent [adaptiveNodes]int // -1 for the root
+	child  [adaptiveNodes]int // -1 for leaves
+	symbol [adaptiveNodes]int
+	leaf   [257]int // position of each symbol's leaf, -1 if it has not been seen
+	next   int      // highest free position, positions are used from the top down
+	path   []uint8
+}
+
+func newAdaptiveTree() *adaptiveTree {
+	t := &adaptiveTree{next: adaptiveRoot - 1}
+	for i := range t.leaf {
+		t.leaf[i] = -1
+	}
+	t.parent[adaptiveRoot] = -1
+	t.child[adaptiveRoot] = -1
+	t.symbol[adaptiveRoot] = nyt
+	t.leaf[nyt] = adaptiveRoot
+	return t
+}
+
+// Swap the contents of positions i and j.
+func (t *adaptiveTree) swap(i int, j int) {
+	t.weight[i], t.weight[j] = t.weight[j], t.weight[i]
+	t.child[i], t.child[j] = t.child[j], t.child[i]
+	t.symbol[i], t.symbol[j] = t.symbol[j], t.symbol[i]
+	for _, p := range []int{i, j} {
+		if t.child[p] < 0 {
+			t.leaf[t.symbol[p]] = p
+		} else {
+			t.parent[t.child[p]] = p
+			t.parent[t.child[p]+1] = p
+		}
+	}
+}
+
+// Split NYT into a new NYT and a leaf for x, and return the position of the new leaf.
+func (t *adaptiveTree) add(x int) int {
+	z := t.leaf[nyt]
+	left := t.next - 1
+	right := t.next
+	t.next -= 2
+	t.child[z] = left
+	t.parent[left] = z
+	t.parent[right] = z
+	t.child[left] = -1
+	t.child[right] = -1
+	t.symbol[left] = nyt
+	t.symbol[right] = x
+	t.leaf[nyt] = left
+	t.leaf[x] = right
+	return right
+}
+
+func (t *adaptiveTree) update(x int) {
+	q := t.leaf[x]
+	if q < 0 {
+		q = t.add(x)
+	}
+	for q >= 0 {
+		leader := q
+		for leader < adaptiveRoot && t.weight[leader+1] == t.weight[q] {
+			leader++
+		}
+		if leader != q && leader != t.parent[q] {
+			t.swap(q, leader)
+			q = leader
+		}
+		t.weight[q]++
+		q = t.parent[q]
+	}
+}
+
+// Write the code for the node at position p.
+func (t *adaptiveTree) writePath(w *bitWriter, p int) {
+	t.path = t.path[:0]
+	for p != adaptiveRoot {
+		t.path = append(t.path, uint8(p-t.child[t.parent[p]]))
+		p = t.parent[p]
+	}
+	for i := len(t.path) - 1; i >= 0; i-- {
+		w.writeCode(code{bits: uint32(t.path[i]), length: 1})
+	}
+}
+
+func (t *adaptiveTree) encodeSymbol(w *bitWriter, x byte) {
+	p := t.leaf[x]
+	if p < 0 {
+		t.writePath(w, t.leaf[nyt])
+		w.writeCode(code{bits: uint32(x), length: 8})
+	} else {
+		t.writePath(w, p)
+	}
+	t.update(int(x))
+}
+
+// Decode a single symbol, whose code may be longer than MaxPeek bits.
+func (t *adaptiveTree) decodeSymbol(r *blockReader) (byte, error) {
+	p := adaptiveRoot
+	for t.child[p] >= 0 {
+		bit, err := r.ReadBit()
+		if err != nil {
+			return 0, io.ErrUnexpectedEOF
+		}
+		p = t.child[p] + int(bit)
+	}
+	x := t.symbol[p]
+	if x == nyt {
+		v, err := r.ReadBits(8)
+		if err != nil {
+			return 0, io.ErrUnexpectedEOF
+		}
+		x = int(v)
+	}
+	t.update(x)
+	return byte(x), nil
+}
+
+// Decode len(out) symbols. Decodes as many whole symbols as fit in every peek of MaxPeek bits,
+// then skips the bits used.
+func (t *adaptiveTree) decode(r *blockReader, out []byte) error {
+	for i := 0; i < len(out); {
+		buf, err := r.PeekBits(bitio.MaxPeek)
+		if err != nil {
+			return err
+		}
+		used := uint(0)
+		for i < len(out) {
+			p := adaptiveRoot
+			n := used
+			for t.child[p] >= 0 && n < bitio.MaxPeek {
+				p = t.child[p] + int(buf>>(bitio.MaxPeek-1-n)&1)
+				n++
+			}
+			if t.child[p] >= 0 {
+				break
+			}
+			x := t.symbol[p]
+			if x == nyt {
+				if n+8 > bitio.MaxPeek {
+					break
+				}
+				x = int(buf >> (bitio.MaxPeek - 8 - n) & 0xff)
+				n += 8
+			}
+			t.update(x)
+			out[i] = byte(x)
+			used = n
+			i++
+		}
+		if used == 0 {
+			out[i], err = t.decodeSymbol(r)
+			if err != nil {
+				return err
+			}
+			i++
+		} else if r.Skip(used) != nil {
+			return io.ErrUnexpectedEOF
+		}
+	}
+	return nil
+}
+
+// Adaptive blocks have no code lengths, the tree carries over from the previous block.
+//
+//	count    uint32  number of bytes in the block, 0 marks the end of the stream
+//	size     uint32  number of bytes of encoded data that follow
+//	pad      uint8   number of zero bits added to fill the last byte of data
+const adaptiveHeaderLen = 4 + 5
+
+func (e *Encoder) encodeAdaptiveBlock(block []byte) []byte {
+	w := newBitWriter(adaptiveHeaderLen, len(block))
+	for _, x := range block {
+		e.tree.encodeSymbol(w, x)
+	}
+	data := w.finishBlock(adaptiveHeaderLen)
+	binary.BigEndian.PutUint32(data, uint32(len(block)))
+	return data
+}
@@ -0,0 +1,251 @@
+package Huffman
+
+import (
+	bitio "compression/bitio"
+	"errors"
+	"io"
+	"sort"
+)
+
+// Canonical huffman codes.
+// Only the code length of each symbol is needed to rebuild the codes:
+// symbols are sorted by (length, value) and given consecutive codes, and the code is
+// doubled every time the length increases by one. This is the same scheme deflate uses.
+
+// Longest code the decoder will accept. Codes are read out of a 64 bit buffer.
+const maxDecodeLen = 32
+
+// Number of bits used to index the primary decode table.
+const tableBits = 12
+
+// Get the depth of every leaf in the tree. Symbols not in the tree get length 0.
+func codeLengths(node *huffmanNode, depth uint8, lengths *[256]uint8) {
+	if node.isLeaf {
+		lengths[node.value] = depth
+		return
+	}
+	codeLengths(node.left, depth+1, lengths)
+	codeLengths(node.right, depth+1, lengths)
+}
+
+// Assign canonical codes from code lengths. codes[x] holds the code for x in its low lengths[x] bits.
+func canonicalCodes(lengths *[256]uint8) [256]uint32 {
+	var codes [256]uint32
+	symbols := []int{}
+	for x, l := range lengths {
+		if l != 0 {
+			symbols = append(symbols, x)
+		}
+	}
+	sort.SliceStable(symbols, func(i, j int) bool {
+		return lengths[symbols[i]] < lengths[symbols[j]]
+	})
+	next := uint32(0)
+	prev := uint8(0)
+	for i, x := range symbols {
+		l := lengths[x]
+		if i > 0 {
+			next = (next + 1) << (l - prev)
+		}
+		codes[x] = next
+		prev = l
+	}
+	return codes
+}
+
+// Make sure the code lengths describe a complete prefix code (Kraft sum of exactly 1).
+func checkLengths(lengths *[256]uint8) error {
+	sum := uint64(0)
+	for _, l := range lengths {
+		if l > maxDecodeLen {
+			return errors.New("huffman: code length too long")
+		}
+		if l != 0 {
+			sum += 1 << (maxDecodeLen - l)
+		}
+	}
+	if sum != 1<<maxDecodeLen {
+		return errors.New("huffman: code lengths do not form a complete code")
+	}
+	return nil
+}
+
+// A code is stored in the low length bits of bits.
+type code struct {
+	bits   uint32
+	length uint8
+}
+
+// Fill dict with the canonical code for each symbol.
+func canonicalDict(lengths *[256]uint8, dict *[256]code) {
+	codes := canonicalCodes(lengths)
+	for x, l := range lengths {
+		dict[x] = code{bits: codes[x], length: l}
+	}
+}
+
+// One entry of a decode table. If length is 0 the entry links to overflow[link],
+// which is indexed by the next bits bits of input after the primary index.
+// When a second code fits in the index after the first one, a primary entry holds both:
+// count is 2, next is the second symbol and total the length of both codes.
+type decodeEntry struct {
+	value  byte
+	length uint8
+	bits   uint8
+	link   uint16
+	next   byte
+	count  uint8
+	total  uint8
+}
+
+// Two level decode table. The primary table is indexed by the next tableBits bits of input.
+// Codes longer than tableBits share a primary entry with every other code that has the same
+// first tableBits bits, and are looked up in that entry's overflow table.
+type decodeTable struct {
+	primary  [1 << tableBits]decodeEntry
+	overflow [][]decodeEntry
+}
+
+func newDecodeTable(lengths *[256]uint8) (*decodeTable, error) {
+	err := checkLengths(lengths)
+	if err != nil {
+		return nil, err
+	}
+	codes := canonicalCodes(lengths)
+	t := &decodeTable{}
+
+	// Size every overflow table to fit the longest code sharing its prefix.
+	subBits := map[uint32]uint8{}
+	for x, l := range lengths {
+		if l > tableBits {
+			prefix := codes[x] >> (l - tableBits)
+			if l-tableBits > subBits[prefix] {
+				subBits[prefix] = l - tableBits
+			}
+		}
+	}
+	prefixes := make([]uint32, 0, len(subBits))
+	for prefix := range subBits {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Slice(prefixes, func(i, j int) bool {
+		return prefixes[i] < prefixes[j]
+	})
+	for _, prefix := range prefixes {
+		t.primary[prefix] = decodeEntry{bits: subBits[prefix], link: uint16(len(t.overflow))}
+		t.overflow = append(t.overflow, make([]decodeEntry, 1<<subBits[prefix]))
+	}
+
+	for x, l := range lengths {
+		switch {
+		case l == 0:
+			continue
+		case l <= tableBits:
+			// Every index that starts with this code decodes to x.
+			start := codes[x] << (tableBits - l)
+			for i := uint32(0); i < 1<<(tableBits-l); i++ {
+				t.primary[start+i] = decodeEntry{value: byte(x), length: l, count: 1, total: l}
+			}
+		default:
+			link := t.primary[codes[x]>>(l-tableBits)]
+			sub := t.overflow[link.link]
+			extra := l - tableBits
+			start := (codes[x] & (1<<extra - 1)) << (link.bits - extra)
+			for i := uint32(0); i < 1<<(link.bits-extra); i++ {
+				sub[start+i] = decodeEntry{value: byte(x), length: l, count: 1, total: l}
+			}
+		}
+	}
+
+	// Pair up codes short enough to share an index.
+	for i := range t.primary {
+		e := t.primary[i]
+		if e.length == 0 {
+			continue
+		}
+		second := t.primary[i<<e.length&(1<<tableBits-1)]
+		if second.length != 0 && e.length+second.length <= tableBits {
+			t.primary[i].next = second.value
+			t.primary[i].count = 2
+			t.primary[i].total = e.length + second.length
+		}
+	}
+	return t, nil
+}
+
+// MSB first bit reader over the data of a block. Peeking past the end of data gives zeros,
+// so callers should check done() once they are done.
+type blockReader struct {
+	*bitio.BitReader
+	valid int64 // bits of data that are not padding
+}
+
+func newBlockReader(data []byte, pad uint8) *blockReader {
+	r := bitio.NewBitReaderBytes(data, bitio.MSB)
+	return &blockReader{BitReader: r, valid: int64(len(data))*8 - int64(pad)}
+}
+
+// Make sure exactly the valid bits were read, no more and no less.
+func (r *blockReader) done() error {
+	if r.BitsRead() > r.valid {
+		return io.ErrUnexpectedEOF
+	}
+	if r.BitsRead() < r.valid {
+		return errors.New("huffman: extra data at end of block")
+	}
+	return nil
+}
+
+// Decode len(out) symbols. Decodes as many symbols as fit in every peek of MaxPeek bits,
+// then skips the bits used. An entry in the primary table uses at most tableBits bits and
+// gives at most two symbols, so the bits and space left are only checked once per run of entries.
+func (t *decodeTable) decode(r *blockReader, out []byte) error {
+	for i := 0; i < len(out); {
+		buf, err := r.PeekBits(bitio.MaxPeek)
+		if err != nil {
+			return err
+		}
+		buf <<= 64 - bitio.MaxPeek
+		used := uint(0)
+		for {
+			n := int(bitio.MaxPeek-used) / tableBits
+			if n > (len(out)-i)/2 {
+				n = (len(out) - i) / 2
+			}
+			for ; n > 0; n-- {
+				e := t.primary[buf>>(64-tableBits)]
+				if e.length == 0 {
+					break
+				}
+				out[i] = e.value
+				out[i+1] = e.next
+				i += int(e.count)
+				buf <<= e.total
+				used += uint(e.total)
+			}
+			if n == 0 && i+2 <= len(out) && used+tableBits <= bitio.MaxPeek {
+				continue
+			}
+			// One symbol at a time: a long code, or the last symbol.
+			if i == len(out) || used+tableBits > bitio.MaxPeek {
+				break
+			}
+			e := t.primary[buf>>(64-tableBits)]
+			if e.length == 0 {
+				if used+tableBits+uint(e.bits) > bitio.MaxPeek {
+					break
+				}
+				e = t.overflow[e.link][buf<<tableBits>>(64-e.bits)]
+			}
+			out[i] = e.value
+			i++
+			buf <<= e.length
+			used += uint(e.length)
+		}
+		err = r.Skip(used)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package Huffman
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var testOptions = []Options{
+	DefaultOptions,
+	{},
+	{MaxCodeLength: 10, BlockSize: 4096},
+	{Adaptive: true, BlockSize: 3000},
+	{Tables: 4, MaxCodeLength: 15},
+	{Coder: CoderRANS},
+	{Coder: CoderRANS, Adaptive: true, BlockSize: 5000},
+	{Coder: CoderTANS, Precision: 12},
+}
+
+func testData(seed int64, n int) []byte {
+	r := rand.New(rand.NewSource(seed))
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(r.ExpFloat64() * 10)
+	}
+	return data
+}
+
+// n bytes of made up English text, with words picked from a Zipf distribution.
+func testText(seed int64, n int) []byte {
+	r := rand.New(rand.NewSource(seed))
+	words := strings.Fields(`the of and to in a is that for it as was with be by on not he I this are
+		or his from at which but have an they you were her she there one all we their been has who
+		more would will if no when what so out up into can 1987 said about other than time only
+		these two may first then do any like my now over such our man me even most made after also`)
+	zipf := rand.NewZipf(r, 1.1, 2, uint64(len(words)-1))
+	var b bytes.Buffer
+	for b.Len() < n {
+		sentence := r.Intn(15) + 3
+		for i := 0; i < sentence; i++ {
+			w := words[zipf.Uint64()]
+			if i == 0 {
+				w = strings.ToUpper(w[:1]) + w[1:]
+			}
+			b.WriteString(w)
+			if i < sentence-1 {
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteString([]string{". ", ", ", "?\n", ".\n\n"}[r.Intn(4)])
+	}
+	return b.Bytes()[:n]
+}
+
+func roundTrip(opts Options, data []byte) ([]byte, error) {
+	var enc bytes.Buffer
+	err := NewEncoder(opts).Encode(&enc, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(NewReader(&enc))
+}
+
+func TestRoundTrip(t *testing.T) {
+	inputs := map[string][]byte{
+		"empty":  {},
+		"one":    []byte("aaaa"),
+		"two":    []byte("abababbbba"),
+		"skewed": testData(1, 20000),
+		"text":   testText(1, 20001),
+	}
+	for i, opts := range testOptions {
+		for name, data := range inputs {
+			out, err := roundTrip(opts, data)
+			if err != nil {
+				t.Errorf("options %d, %s: %v", i, name, err)
+			} else if !bytes.Equal(out, data) {
+				t.Errorf("options %d, %s: decoded data does not match", i, name)
+			}
+		}
+	}
+}
+
+// Separate Encoders and Readers share nothing, so they can run at the same time.
+// Run with go test -race.
+func TestConcurrentRoundTrip(t *testing.T) {
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		for i, opts := range testOptions {
+			wg.Add(1)
+			go func(g int, i int, opts Options) {
+				defer wg.Done()
+				data := testData(int64(g*len(testOptions)+i), 30000)
+				out, err := roundTrip(opts, data)
+				if err != nil {
+					t.Errorf("goroutine %d, options %d: %v", g, i, err)
+				} else if !bytes.Equal(out, data) {
+					t.Errorf("goroutine %d, options %d: decoded data does not match", g, i)
+				}
+			}(g, i, opts)
+		}
+	}
+	wg.Wait()
+}
+
+// Decode speed, on the go source of the repo repeated to 1MB.
+func BenchmarkDecode(b *testing.B) {
+	files, _ := filepath.Glob("../*/*.go")
+	text := []byte{}
+	for len(text) < 1<<20 {
+		for _, f := range files {
+			data, err := os.ReadFile(f)
+			if err != nil {
+				b.Fatal(err)
+			}
+			text = append(text, data...)
+		}
+	}
+	text = text[:1<<20]
+	coders := map[string]Options{
+		"static":   DefaultOptions,
+		"adaptive": {Adaptive: true, BlockSize: 1 << 16},
+		"multi":    {Tables: 4, MaxCodeLength: 15},
+		"rans":     {Coder: CoderRANS},
+		"tans":     {Coder: CoderTANS},
+	}
+	for name, opts := range coders {
+		var enc bytes.Buffer
+		err := NewEncoder(opts).Encode(&enc, bytes.NewReader(text))
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(name, func(b *testing.B) {
+			b.SetBytes(int64(len(text)))
+			for i := 0; i < b.N; i++ {
+				_, err := io.Copy(io.Discard, NewReader(bytes.NewReader(enc.Bytes())))
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// Blocks that claim more bytes or more coded data than they can hold are rejected before
+// anything is allocated for them.
+func TestCorruptSizes(t *testing.T) {
+	data := testData(1, 1000)
+	for _, opts := range []Options{DefaultOptions, {Adaptive: true}, {Tables: 4}, {Coder: CoderRANS}, {Coder: CoderTANS}} {
+		var enc bytes.Buffer
+		err := NewEncoder(opts).Encode(&enc, bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		block := len(magic) + 2
+		headerLen := map[byte]int{modeStatic: blockHeaderLen, modeAdaptive: adaptiveHeaderLen,
+			modeRANS: ransHeaderLen, modeTANS: tansHeaderLen}[enc.Bytes()[len(magic)+1]]
+		if enc.Bytes()[len(magic)+1] == modeMulti {
+			headerLen = 4 + 1 + int(enc.Bytes()[block+4])*256 + 5
+		}
+		for _, field := range []int{block, block + headerLen - 5} {
+			corrupt := append([]byte{}, enc.Bytes()...)
+			binary.BigEndian.PutUint32(corrupt[field:], 0xffffffff)
+			_, err = io.ReadAll(NewReader(bytes.NewReader(corrupt)))
+			if err == nil || err == io.ErrUnexpectedEOF {
+				t.Errorf("mode %d, field at %d: %v", corrupt[len(magic)+1], field, err)
+			}
+		}
+	}
+}
@@ -1,18 +1,107 @@
 package Huffman
 
 import (
+	"bufio"
+	"bytes"
+	ans "compression/ans"
 	"fmt"
+	"io"
 	"log"
-	"math"
 	"os"
 	"sort"
 )
 
-var filepath = "enwik8"
-var outPath = "enwik8_encoded"
+// Options for the encoder.
+type Options struct {
+	// Longest code the encoder is allowed to use. Codes are built with package-merge (see limit.go)
+	// when this is set, and with huffmanTree when it is 0, which gives the optimal code unless it
+	// would be longer than the decoder accepts. Limits over 32 bits, the longest code the decoder
+	// accepts, are taken as 32.
+	MaxCodeLength int
+	// Number of input bytes coded with the same code lengths. Defaults to 1MB, up to MaxBlockSize.
+	BlockSize int
+	// Use one pass adaptive huffman coding (see adaptive.go) instead of per block code lengths.
+	// MaxCodeLength is ignored.
+	Adaptive bool
+	// Most code tables per block, up to 6 (see multi.go). 0 or 1 uses a single table.
+	// Ignored when Adaptive is set.
+	Tables int
+	// Entropy coder for the bytes of each block. CoderHuffman, the default, writes huffman codes.
+	// CoderRANS codes the same frequencies with rANS instead (see rans.go), and CoderTANS with
+	// tANS (see tans.go). Both ignore MaxCodeLength and Tables. With Adaptive, the rANS frequencies
+	// follow the data; CoderTANS ignores Adaptive.
+	Coder Coder
+	// Bits of precision of the ANS frequencies, from ans.MinPrecision to ans.MaxPrecision.
+	// Defaults to ans.DefaultPrecision.
+	Precision int
+}
+
+// Coder picks the entropy coder used for the counted frequencies.
+type Coder int
+
+const (
+	CoderHuffman Coder = iota
+	CoderRANS
+	CoderTANS
+)
+
+// DefaultOptions limits codes to 15 bits, the same as deflate.
+var DefaultOptions = Options{MaxCodeLength: 15, BlockSize: defaultBlockSize}
+
+// Encoder owns the frequency table and code dictionary for the block it is encoding,
+// so separate Encoders can be used from separate goroutines.
+// A single Encoder is not safe for concurrent use.
+type Encoder struct {
+	opts Options
+	freq map[byte]int
+	dict [256]code
+	tree *adaptiveTree
+	// Adaptive rANS table, made with the first block.
+	model *ans.Adaptive
+}
 
-var freq = map[byte]int{}
-var dict = map[byte][]int{}
+// NewEncoder returns an Encoder using opts.
+func NewEncoder(opts Options) *Encoder {
+	if opts.BlockSize <= 0 {
+		opts.BlockSize = defaultBlockSize
+	}
+	if opts.BlockSize > MaxBlockSize {
+		opts.BlockSize = MaxBlockSize
+	}
+	if opts.MaxCodeLength > maxDecodeLen {
+		opts.MaxCodeLength = maxDecodeLen
+	}
+	if opts.Precision == 0 {
+		opts.Precision = ans.DefaultPrecision
+	}
+	return &Encoder{opts: opts, freq: map[byte]int{}}
+}
+
+func (e *Encoder) mode() byte {
+	switch {
+	case e.opts.Coder == CoderTANS:
+		return modeTANS
+	case e.opts.Coder == CoderRANS && e.opts.Adaptive:
+		return modeRANSAdaptive
+	case e.opts.Coder == CoderRANS:
+		return modeRANS
+	case e.opts.Adaptive:
+		return modeAdaptive
+	case e.opts.Tables > 1:
+		return modeMulti
+	}
+	return modeStatic
+}
+
+// Encode compresses everything read from r and writes it to w.
+func (e *Encoder) Encode(w io.Writer, r io.Reader) error {
+	z := newWriter(w, e)
+	_, err := io.Copy(z, r)
+	if err != nil {
+		return err
+	}
+	return z.Close()
+}
 
 type huffmanNode struct {
 	frequency int
@@ -22,219 +111,225 @@ type huffmanNode struct {
 	isLeaf    bool
 }
 
-func minTree(sorted []byte) *huffmanNode {
-	root := huffmanNode{value: sorted[0], frequency: freq[sorted[0]], isLeaf: true}
-	queue := []*huffmanNode{&root}
-	i := 1
-
-	for len(queue) != 0 {
-		pop := queue[0]
-		queue = queue[1:]
-		if i == len(sorted) {
-			break
+// Build a huffman tree for the symbols in freq with the two queue method. Leaves sorted by
+// frequency go in one queue, and parents in another. Parents are made in order of frequency, so the
+// two smallest nodes are always at the front of the queues. Ties take leaves first, which keeps
+// the tree shallow.
+func huffmanTree(freq map[byte]int) *huffmanNode {
+	leaves := make([]*huffmanNode, 0, len(freq))
+	for x, f := range freq {
+		leaves = append(leaves, &huffmanNode{value: x, frequency: f, isLeaf: true})
+	}
+	sort.Slice(leaves, func(i, j int) bool {
+		if leaves[i].frequency == leaves[j].frequency {
+			return leaves[i].value < leaves[j].value
 		}
-		left := huffmanNode{value: sorted[i], frequency: freq[sorted[i]], isLeaf: true}
-		pop.left = &left
-		queue = append(queue, &left)
-		i++
-		if i == len(sorted) {
-			break
+		return leaves[i].frequency < leaves[j].frequency
+	})
+	parents := []*huffmanNode{}
+	smallest := func() *huffmanNode {
+		var n *huffmanNode
+		if len(parents) == 0 || (len(leaves) > 0 && leaves[0].frequency <= parents[0].frequency) {
+			n, leaves = leaves[0], leaves[1:]
+		} else {
+			n, parents = parents[0], parents[1:]
 		}
-		right := huffmanNode{value: sorted[i], frequency: freq[sorted[i]], isLeaf: true}
-		pop.right = &right
-		queue = append(queue, &right)
-		i++
+		return n
 	}
-	return &root
+	for len(leaves)+len(parents) > 1 {
+		left := smallest()
+		right := smallest()
+		parents = append(parents, &huffmanNode{frequency: left.frequency + right.frequency, left: left, right: right})
+	}
+	return smallest()
 }
 
-func queueSort(queue []*huffmanNode) []*huffmanNode {
-	sort.Slice(queue, func(i, j int) bool {
-		return queue[i].frequency < queue[j].frequency
-	})
-	return queue
-}
+// File format:
+//
+//	magic    [4]byte  "HUFF"
+//	version  uint8
+//	mode     uint8    modeStatic, modeAdaptive, modeMulti, modeRANS, modeRANSAdaptive or modeTANS
+//	blocks            see stream.go, adaptive.go, multi.go, rans.go and tans.go
+//	end      uint32   0
+var magic = []byte("HUFF")
 
-func pop(queue []*huffmanNode) (*huffmanNode, []*huffmanNode) {
-	return queue[0], queue[1:]
-}
+const version = 5
 
-// get mintree,
-// get two smallest nodes, create parent node for them
-// continue until there is only one parent, return as root
-func huffmanTree(tree *huffmanNode) *huffmanNode {
-	queue := []*huffmanNode{tree}
-	children := []*huffmanNode{}
-	root := &huffmanNode{}
-	for len(queue) > 0 {
-		root, queue = pop(queue)
-		if root.isLeaf {
-			rooter := *root
-			if root.left != nil {
-				queue = append(queue, rooter.left)
-			}
-			if root.right != nil {
-				queue = append(queue, rooter.right)
-			}
-			trimKids := huffmanNode{value: rooter.value, frequency: rooter.frequency, isLeaf: true}
-			children = append(children, &trimKids)
-		} else {
-			children = append(children, root)
-		}
+const (
+	modeStatic   = 0
+	modeAdaptive = 1
+	modeMulti    = 2
+	// Blocks coded with rANS and tANS from package ans.
+	modeRANS         = 3
+	modeRANSAdaptive = 4
+	modeTANS         = 5
+)
 
-		if len(children) == 2 {
-			parent := huffmanNode{frequency: children[0].frequency + children[1].frequency, isLeaf: false, left: children[0], right: children[1]}
-			queue = append(queue, &parent)
-			children = []*huffmanNode{}
+// Get code lengths for the symbols counted in freq.
+func buildLengths(freq map[byte]int, opts Options) ([256]uint8, error) {
+	var lengths [256]uint8
+	if len(freq) == 1 {
+		// A tree with one leaf has no edges, so there would be no bits to write.
+		// Pair the symbol with an unused one so it gets a one bit code and the code stays complete.
+		for x := range freq {
+			lengths[x] = 1
+			lengths[x^1] = 1
 		}
+		return lengths, nil
 	}
-	return root
-}
-
-func createDict(node *huffmanNode, ret []int) {
-	if node.isLeaf {
-		dict[node.value] = ret
-		return
-		//fmt.Println(node.value, string(node.value), ret, node.frequency)
+	if opts.MaxCodeLength > 0 {
+		return limitedLengths(freq, opts.MaxCodeLength)
+	}
+	codeLengths(huffmanTree(freq), 0, &lengths)
+	for _, l := range lengths {
+		if l > maxDecodeLen {
+			// Very skewed counts can make the tree deeper than the decoder allows.
+			return limitedLengths(freq, maxDecodeLen)
+		}
 	}
-	rl := make([]int, len(ret))
-	copy(rl, ret)
-	rl = append(rl, 0)
-	createDict(node.left, rl)
-	rr := make([]int, len(ret))
-	copy(rr, ret)
-	rr = append(rr, 1)
-	createDict(node.right, rr)
-	return
+	if err := checkLengths(&lengths); err != nil {
+		return lengths, err
+	}
+	return lengths, nil
 }
 
-// Convert byte to int
-func writeBits(ints []int) int {
-	i := len(ints)
-	ex := float64(-1)
-	ret := 0
-	for i > 0 {
-		i--
-		ex++
-		ret += ints[i] * int(math.Pow(2, ex))
-	}
-	return ret
+// Encode compresses the file at inPath with DefaultOptions and writes the result to outPath.
+func Encode(inPath string, outPath string) error {
+	return EncodeOptions(inPath, outPath, DefaultOptions)
 }
 
-// Convert int to byte
-func readBits(b int) []int {
-	ret := []int{0, 0, 0, 0, 0, 0, 0, 0}
-	if b >= 256 {
-		fmt.Println("ERROR, tried to convert integer >=256 to byte")
-		return ret
+// EncodeOptions is Encode with the given options.
+func EncodeOptions(inPath string, outPath string, opts Options) error {
+	in, err := os.Open(inPath)
+	if err != nil {
+		return err
 	}
-	i := 8
-	ex := float64(0)
-	for i >= 1 {
-		i--
-		ex++
-		temp := b % int(math.Pow(2, ex))
-		if temp == b {
-			ret[i] = 1
-			break
-		} else if temp != 0 {
-			ret[i] = 1
-			b = b - temp
-		}
+	defer in.Close()
+	out, err := os.Create(outPath)
+	if err != nil {
+		return err
 	}
-	return ret
+	defer out.Close()
+	bw := bufio.NewWriter(out)
+	err = NewEncoder(opts).Encode(bw, in)
+	if err != nil {
+		return err
+	}
+	err = bw.Flush()
+	if err != nil {
+		return err
+	}
+	return out.Close()
 }
 
-func encode(bytes []byte, outPath string) *huffmanNode {
-	for _, x := range bytes {
-		freq[x] += 1
+// Decode reads a file written by Encode from inPath and writes the original bytes to outPath.
+func Decode(inPath string, outPath string) error {
+	in, err := os.Open(inPath)
+	if err != nil {
+		return err
 	}
-	sorted := make([]byte, len(freq))
-	y := 0
-	for i := range freq {
-		sorted[y] = i
-		y++
+	defer in.Close()
+	out, err := os.Create(outPath)
+	if err != nil {
+		return err
 	}
-	sort.Slice(sorted, func(i, j int) bool {
-		return freq[sorted[i]] < freq[sorted[j]]
-	})
-	minT := minTree(sorted)
-	hufT := huffmanTree(minT)
-	fmt.Println("creating dict...")
-	createDict(hufT, []int{})
-	fmt.Println("encoding...")
-	intData := []int{}
-	for i, x := range bytes {
-		intData = append(intData, dict[x]...)
-		if i%(len(bytes)/10) == 0 {
-			fmt.Println(i, "/", len(bytes))
-		}
+	defer out.Close()
+	bw := bufio.NewWriter(out)
+	_, err = io.Copy(bw, NewReader(in))
+	if err != nil {
+		return err
 	}
-	fmt.Println("converting to bytes...")
-	data := []byte{}
-	i := 0
-	for i < len(intData) {
-		temp := writeBits(intData[i : i+8])
-		data = append(data, byte(temp))
-		i += 8
+	err = bw.Flush()
+	if err != nil {
+		return err
 	}
-	fmt.Println("writing to file...")
-	os.WriteFile(outPath, data, os.ModeDevice)
-	fmt.Println("done")
-	fmt.Println()
+	return out.Close()
+}
 
-	return hufT
+func HuffMain(filepath string, outPath string) {
+	HuffMainOptions(filepath, outPath, DefaultOptions)
 }
 
-func decode(outPath string, hufT *huffmanNode) (string, int) {
+// HuffMainOptions is HuffMain with the given encoder options.
+func HuffMainOptions(filepath string, outPath string, opts Options) {
+	info, err := os.Stat(filepath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	size := info.Size()
+	fmt.Println("Bytes: ", size)
+	fmt.Println("Bits: ", size*8)
+	fmt.Println(" ")
+	fmt.Println(" ------- ")
+	fmt.Println(" ")
+
+	err = EncodeOptions(filepath, outPath, opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("done")
+	fmt.Println()
+
 	fmt.Println("Reading encoded data...")
 	fmt.Println()
-	bytes, err := os.ReadFile(outPath)
+	info, err = os.Stat(outPath)
 	if err != nil {
 		log.Fatal(err)
 	}
-	fmt.Println("Compressed Bytes: ", len(bytes))
-	fmt.Println("Compressed Bits: ", len(bytes)*8)
-	//intData := make([]int, 0, len(bytes)*8) //NOTE: this should work to preallocate the required memory while still intilializing a slice of length 0
-	//readBits() returns a slice of 8 ints, so it is easier to initialize intData without specifying length and just keep appending the list to intData. However, if you want to initialize intData with the correct length, you would have to assign each int returned by readBits to the correct index in intData
-	intData := []int{}
-	for _, x := range bytes {
-		intData = append(intData, readBits(int(x))...)
+	encSize := info.Size()
+	fmt.Println("Compressed Bytes: ", encSize)
+	fmt.Println("Compressed Bits: ", encSize*8)
+	same, err := sameFiles(filepath, outPath)
+	if err != nil {
+		log.Fatal(err)
 	}
-	data := []byte{}
-	root := hufT
-	for _, i := range intData {
-		if root.isLeaf == true {
-			data = append(data, root.value)
-			root = hufT
-		}
-		if i == 0 {
-			root = root.left
-		} else if i == 1 {
-			root = root.right
-		}
-
+	if !same {
+		log.Fatal("decoded data does not match original")
+	}
+	if size > 0 {
+		fmt.Println(" ")
+		fmt.Println("New file is ", 100*encSize/size, "% of the size of origional file")
 	}
-	return string(data), len(bytes)
 }
 
-func HuffMain(fp string, op string) {
-	filepath = fp
-	outPath = op
-	bytes, err := os.ReadFile(filepath)
+// Check that decoding the file at encPath gives back the file at origPath, one chunk at a time.
+func sameFiles(origPath string, encPath string) (bool, error) {
+	orig, err := os.Open(origPath)
 	if err != nil {
-		log.Fatal(err)
+		return false, err
+	}
+	defer orig.Close()
+	enc, err := os.Open(encPath)
+	if err != nil {
+		return false, err
+	}
+	defer enc.Close()
+	a := bufio.NewReader(orig)
+	b := bufio.NewReader(NewReader(enc))
+	bufA := make([]byte, 1<<16)
+	bufB := make([]byte, 1<<16)
+	for {
+		n, errA := io.ReadFull(a, bufA)
+		m, errB := io.ReadFull(b, bufB)
+		if !bytes.Equal(bufA[:n], bufB[:m]) {
+			return false, nil
+		}
+		if errA == io.EOF || errA == io.ErrUnexpectedEOF {
+			if errB == io.EOF || errB == io.ErrUnexpectedEOF {
+				return true, nil
+			}
+			return false, nil
+		}
+		if errA != nil {
+			return false, errA
+		}
+		if errB != nil {
+			if errB == io.EOF || errB == io.ErrUnexpectedEOF {
+				return false, nil
+			}
+			return false, errB
+		}
 	}
-	fmt.Println("Bytes: ", len(bytes))
-	fmt.Println("Bits: ", len(bytes)*8)
-	fmt.Println(" ")
-	fmt.Println(" ------- ")
-	fmt.Println(" ")
-
-	hufT := encode(bytes, outPath)
-	_, deced := decode(outPath, hufT)
-	fmt.Println(" ")
-	fmt.Println("New file is ", 100*deced/len(bytes), "% of the size of origional file")
 }
 
 //------------------------------------------
@@ -0,0 +1,89 @@
+package Huffman
+
+import (
+	"errors"
+	"sort"
+)
+
+// Length limited huffman codes using the package-merge algorithm.
+// https://en.wikipedia.org/wiki/Package-merge_algorithm
+//
+// Think of every symbol as a coin with value 2^-1 ... 2^-maxLen and weight freq.
+// We want the lightest set of coins with a total value of n-1, where n is the number of symbols.
+// Building the lists of coins from the smallest value up, each list is the symbols themselves
+// merged with the previous list "packaged" into pairs. The code length of a symbol is the number
+// of times it is used in the first 2n-2 items of the last list.
+// With maxLen >= n-1 the limit is never reached and the result is an optimal huffman code.
+
+type pmItem struct {
+	weight  int
+	symbols []byte
+}
+
+// Get code lengths for every symbol in freq, no longer than maxLen.
+func limitedLengths(freq map[byte]int, maxLen int) ([256]uint8, error) {
+	var lengths [256]uint8
+	leaves := []pmItem{}
+	for x, f := range freq {
+		if f > 0 {
+			leaves = append(leaves, pmItem{weight: f, symbols: []byte{x}})
+		}
+	}
+	if len(leaves) < 2 {
+		return lengths, errors.New("huffman: need at least two symbols")
+	}
+	if maxLen > maxDecodeLen || 1<<maxLen < len(leaves) {
+		return lengths, errors.New("huffman: cannot build code with that max length")
+	}
+	sort.Slice(leaves, func(i, j int) bool {
+		if leaves[i].weight == leaves[j].weight {
+			return leaves[i].symbols[0] < leaves[j].symbols[0]
+		}
+		return leaves[i].weight < leaves[j].weight
+	})
+
+	list := leaves
+	for l := 1; l < maxLen; l++ {
+		packages := []pmItem{}
+		for i := 0; i+1 < len(list); i += 2 {
+			symbols := make([]byte, 0, len(list[i].symbols)+len(list[i+1].symbols))
+			symbols = append(symbols, list[i].symbols...)
+			symbols = append(symbols, list[i+1].symbols...)
+			packages = append(packages, pmItem{weight: list[i].weight + list[i+1].weight, symbols: symbols})
+		}
+		list = pmMerge(leaves, packages)
+	}
+
+	for _, item := range list[:2*len(leaves)-2] {
+		for _, x := range item.symbols {
+			lengths[x]++
+		}
+	}
+	return lengths, nil
+}
+
+// Merge two lists sorted by weight. Leaves go first on ties, which keeps codes short.
+func pmMerge(a []pmItem, b []pmItem) []pmItem {
+	ret := make([]pmItem, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if a[i].weight <= b[j].weight {
+			ret = append(ret, a[i])
+			i++
+		} else {
+			ret = append(ret, b[j])
+			j++
+		}
+	}
+	ret = append(ret, a[i:]...)
+	return append(ret, b[j:]...)
+}
+
+// Total number of bits needed to encode the data that freq was counted from.
+func encodedBits(freq map[byte]int, lengths *[256]uint8) int {
+	total := 0
+	for x, f := range freq {
+		total += f * int(lengths[x])
+	}
+	return total
+}
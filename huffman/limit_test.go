@@ -0,0 +1,178 @@
+package Huffman
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func countBytes(data []byte) map[byte]int {
+	freq := map[byte]int{}
+	for _, x := range data {
+		freq[x] += 1
+	}
+	return freq
+}
+
+// Byte counts to test code lengths with.
+func testFreqs(t *testing.T) map[string]map[byte]int {
+	r := rand.New(rand.NewSource(1))
+	uniform := make([]byte, 50000)
+	r.Read(uniform)
+	skewed := make([]byte, 50000)
+	for i := range skewed {
+		skewed[i] = byte(r.ExpFloat64() * 6)
+	}
+	// Counts that grow like the Fibonacci numbers give the deepest trees.
+	fib := map[byte]int{}
+	a, b := 1, 1
+	for x := 0; x < 30; x++ {
+		fib[byte(x)] = a
+		a, b = b, a+b
+	}
+	return map[string]map[byte]int{
+		"uniform":   countBytes(uniform),
+		"skewed":    countBytes(skewed),
+		"text":      countBytes(testText(1, 100000)),
+		"fibonacci": fib,
+	}
+}
+
+// Cost of an optimal code, as the sum of the weights of all the parents huffman's algorithm makes.
+// Done the slow way, by searching for the two smallest weights every time.
+func optimalBits(freq map[byte]int) int {
+	weights := []int{}
+	for _, f := range freq {
+		weights = append(weights, f)
+	}
+	total := 0
+	for len(weights) > 1 {
+		for k := 0; k < 2; k++ {
+			min := k
+			for i := k; i < len(weights); i++ {
+				if weights[i] < weights[min] {
+					min = i
+				}
+			}
+			weights[k], weights[min] = weights[min], weights[k]
+		}
+		parent := weights[0] + weights[1]
+		total += parent
+		weights = append(weights[2:], parent)
+	}
+	return total
+}
+
+func longestLength(lengths *[256]uint8) uint8 {
+	longest := uint8(0)
+	for _, l := range lengths {
+		if l > longest {
+			longest = l
+		}
+	}
+	return longest
+}
+
+// Cost of a code that is known to fit in maxLen bits: the optimal lengths plus one, cut off at
+// maxLen. Adding one halves the Kraft sum of the uncut codes, and the cut ones add at most
+// n/2^maxLen, so it is a valid code when there are no more than 2^(maxLen-1) symbols.
+// Otherwise every symbol gets the same length.
+func penaltyBits(t *testing.T, freq map[byte]int, maxLen int) int {
+	opt, err := buildLengths(freq, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(freq) > 1<<(maxLen-1) {
+		flat := 0
+		for 1<<flat < len(freq) {
+			flat++
+		}
+		total := 0
+		for _, f := range freq {
+			total += f * flat
+		}
+		return total
+	}
+	var lengths [256]uint8
+	for x := range freq {
+		lengths[x] = opt[x] + 1
+		if int(lengths[x]) > maxLen {
+			lengths[x] = uint8(maxLen)
+		}
+	}
+	return encodedBits(freq, &lengths)
+}
+
+func TestOptimalLengths(t *testing.T) {
+	for name, freq := range testFreqs(t) {
+		opt := optimalBits(freq)
+		for _, maxLen := range []int{0, maxDecodeLen} {
+			lengths, err := buildLengths(freq, Options{MaxCodeLength: maxLen})
+			if err != nil {
+				t.Fatalf("%s, limit %d: %v", name, maxLen, err)
+			}
+			if bits := encodedBits(freq, &lengths); bits != opt {
+				t.Errorf("%s, limit %d: %d bits, optimal is %d", name, maxLen, bits, opt)
+			}
+		}
+	}
+}
+
+func TestLimitedLengths(t *testing.T) {
+	for name, freq := range testFreqs(t) {
+		opt := optimalBits(freq)
+		prev := -1
+		for _, maxLen := range []int{8, 12, 15} {
+			lengths, err := buildLengths(freq, Options{MaxCodeLength: maxLen})
+			if err != nil {
+				t.Fatalf("%s, limit %d: %v", name, maxLen, err)
+			}
+			if err := checkLengths(&lengths); err != nil {
+				t.Errorf("%s, limit %d: %v", name, maxLen, err)
+			}
+			if longestLength(&lengths) > uint8(maxLen) {
+				t.Errorf("%s, limit %d: code of length %d", name, maxLen, longestLength(&lengths))
+			}
+			bits := encodedBits(freq, &lengths)
+			if bits < opt || bits > penaltyBits(t, freq, maxLen) {
+				t.Errorf("%s, limit %d: %d bits, optimal is %d, with penalty %d", name, maxLen, bits, opt, penaltyBits(t, freq, maxLen))
+			}
+			if prev >= 0 && bits > prev {
+				t.Errorf("%s, limit %d: %d bits, more than %d with a tighter limit", name, maxLen, bits, prev)
+			}
+			prev = bits
+		}
+	}
+}
+
+// Counts that would give a tree deeper than the decoder accepts get limited codes instead.
+func TestDeepTree(t *testing.T) {
+	freq := map[byte]int{}
+	a, b := 1, 1
+	for x := 0; x < 45; x++ {
+		freq[byte(x)] = a
+		a, b = b, a+b
+	}
+	lengths, err := buildLengths(freq, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if longestLength(&lengths) > maxDecodeLen {
+		t.Errorf("code of length %d", longestLength(&lengths))
+	}
+	if err := checkLengths(&lengths); err != nil {
+		t.Error(err)
+	}
+}
+
+// Limits looser than the decoder's are met with its limit.
+func TestLooseLimit(t *testing.T) {
+	data := testData(1, 5000)
+	out, err := roundTrip(Options{MaxCodeLength: 40}, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Error("decoded data does not match")
+	}
+}
@@ -0,0 +1,303 @@
+package Huffman
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Several code tables per block, like bzip2.
+// The block is split into groups of groupSize symbols, and every group picks the table that
+// codes it in the fewest bits. Tables start out as the code lengths of equal slices of the block,
+// and are refined by recounting each table's frequencies from the groups that picked it.
+// Every table takes 256 bytes of header, so a block uses fewer tables if that comes out smaller.
+//
+// Multi table block:
+//
+//	count    uint32               number of bytes in the block, 0 marks the end of the stream
+//	tables   uint8                number of code tables
+//	lengths  [tables][256]uint8   code lengths of every table
+//	size     uint32               number of bytes of encoded data that follow
+//	pad      uint8                number of zero bits added to fill the last byte of data
+//	data                          selectors, then the symbols of each group coded with its table
+//
+// One selector is stored per group, move-to-front coded and written in unary (bzip2 does the same).
+
+const groupSize = 50
+const maxTables = 6
+const refineIterations = 4
+
+// Number of bits needed to code group with a table.
+func groupCost(group []byte, lengths *[256]uint8) int {
+	cost := 0
+	for _, x := range group {
+		cost += int(lengths[x])
+	}
+	return cost
+}
+
+// Build code lengths for every table from the groups assigned to it. Every symbol in the block
+// is given a count of at least 1 in every table, so any table can code any group.
+func (e *Encoder) tableLengths(block []byte, selectors []uint8, tables int) ([][256]uint8, error) {
+	freqs := make([]map[byte]int, tables)
+	for t := range freqs {
+		freqs[t] = map[byte]int{}
+		for x := range e.freq {
+			freqs[t][x] = 1
+		}
+	}
+	for g, t := range selectors {
+		end := (g + 1) * groupSize
+		if end > len(block) {
+			end = len(block)
+		}
+		for _, x := range block[g*groupSize : end] {
+			freqs[t][x] += 1
+		}
+	}
+	lengths := make([][256]uint8, tables)
+	for t := range lengths {
+		var err error
+		lengths[t], err = buildLengths(freqs[t], e.opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return lengths, nil
+}
+
+// Pick the cheapest table for every group.
+func selectTables(block []byte, selectors []uint8, lengths [][256]uint8) {
+	for g := range selectors {
+		end := (g + 1) * groupSize
+		if end > len(block) {
+			end = len(block)
+		}
+		best := -1
+		for t := range lengths {
+			cost := groupCost(block[g*groupSize:end], &lengths[t])
+			if best < 0 || cost < best {
+				best = cost
+				selectors[g] = uint8(t)
+			}
+		}
+	}
+}
+
+// Move-to-front code the selectors. Every selector becomes its position in the list of tables
+// ordered by last use, and is written in unary.
+func mtfSelectors(selectors []uint8) []int {
+	ranks := make([]int, len(selectors))
+	mtf := []uint8{0, 1, 2, 3, 4, 5}
+	for g, t := range selectors {
+		j := 0
+		for mtf[j] != t {
+			j++
+		}
+		copy(mtf[1:j+1], mtf[:j])
+		mtf[0] = t
+		ranks[g] = j
+	}
+	return ranks
+}
+
+// Build the given number of tables for block and assign them to groups. Also returns the
+// number of bits the tables, selectors and codes take.
+func (e *Encoder) fitTables(block []byte, groups int, tables int) ([]uint8, [][256]uint8, int, error) {
+	// Start with equal slices of the block.
+	selectors := make([]uint8, groups)
+	for g := range selectors {
+		selectors[g] = uint8(g * tables / groups)
+	}
+	lengths, err := e.tableLengths(block, selectors, tables)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	for i := 0; i < refineIterations && tables > 1; i++ {
+		selectTables(block, selectors, lengths)
+		lengths, err = e.tableLengths(block, selectors, tables)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+	}
+	selectTables(block, selectors, lengths)
+
+	cost := tables * 256 * 8
+	for g, j := range mtfSelectors(selectors) {
+		end := (g + 1) * groupSize
+		if end > len(block) {
+			end = len(block)
+		}
+		cost += j + 1 + groupCost(block[g*groupSize:end], &lengths[selectors[g]])
+	}
+	return selectors, lengths, cost, nil
+}
+
+// Number of tables that save less than their header over coding the groups that picked them
+// with the next best table.
+func weakTables(block []byte, selectors []uint8, lengths [][256]uint8) int {
+	saved := make([]int, len(lengths))
+	for g, t := range selectors {
+		end := (g + 1) * groupSize
+		if end > len(block) {
+			end = len(block)
+		}
+		own := groupCost(block[g*groupSize:end], &lengths[t])
+		next := -1
+		for u := range lengths {
+			if u == int(t) {
+				continue
+			}
+			cost := groupCost(block[g*groupSize:end], &lengths[u])
+			if next < 0 || cost < next {
+				next = cost
+			}
+		}
+		saved[t] += next - own
+	}
+	weak := 0
+	for _, s := range saved {
+		if s < 256*8 {
+			weak++
+		}
+	}
+	return weak
+}
+
+func (e *Encoder) encodeMultiBlock(block []byte) ([]byte, error) {
+	for x := range e.freq {
+		delete(e.freq, x)
+	}
+	for _, x := range block {
+		e.freq[x] += 1
+	}
+	groups := (len(block) + groupSize - 1) / groupSize
+	tables := e.opts.Tables
+	if tables > maxTables {
+		tables = maxTables
+	}
+	if tables > groups {
+		tables = groups
+	}
+
+	selectors, lengths, cost, err := e.fitTables(block, groups, tables)
+	if err != nil {
+		return nil, err
+	}
+	// Every table costs 256 bytes of header. While some of them save less than that, try doing
+	// without them.
+	for tables > 1 {
+		fewer := tables - weakTables(block, selectors, lengths)
+		if fewer == tables {
+			break
+		}
+		if fewer < 1 {
+			fewer = 1
+		}
+		s, l, c, err := e.fitTables(block, groups, fewer)
+		if err != nil {
+			return nil, err
+		}
+		if c > cost {
+			break
+		}
+		selectors, lengths, cost, tables = s, l, c, fewer
+	}
+
+	headerLen := 4 + 1 + tables*256 + 5
+	w := newBitWriter(headerLen, len(block))
+	for _, j := range mtfSelectors(selectors) {
+		for ; j > 0; j-- {
+			w.writeCode(code{bits: 1, length: 1})
+		}
+		w.writeCode(code{bits: 0, length: 1})
+	}
+	dicts := make([][256]code, tables)
+	for t := range dicts {
+		canonicalDict(&lengths[t], &dicts[t])
+	}
+	for i, x := range block {
+		w.writeCode(dicts[selectors[i/groupSize]][x])
+	}
+	data := w.finishBlock(headerLen)
+
+	binary.BigEndian.PutUint32(data, uint32(len(block)))
+	data[4] = uint8(tables)
+	for t := range lengths {
+		copy(data[5+t*256:], lengths[t][:])
+	}
+	return data, nil
+}
+
+func (z *Reader) readMultiBlock(count uint32) error {
+	header := make([]byte, 1)
+	_, err := io.ReadFull(z.r, header)
+	if err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	tables := int(header[0])
+	if tables < 1 || tables > maxTables {
+		return errors.New("huffman: corrupt block header")
+	}
+	header = make([]byte, tables*256)
+	_, err = io.ReadFull(z.r, header)
+	if err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	decodeTables := make([]*decodeTable, tables)
+	for t := range decodeTables {
+		var lengths [256]uint8
+		copy(lengths[:], header[t*256:])
+		decodeTables[t], err = newDecodeTable(&lengths)
+		if err != nil {
+			return err
+		}
+	}
+	groups := (int(count) + groupSize - 1) / groupSize
+	// Every selector and every symbol takes at least one bit. Selectors take at most maxTables.
+	r, err := z.readData(uint64(count)+uint64(groups), uint64(count)*maxDecodeLen+uint64(groups)*maxTables)
+	if err != nil {
+		return err
+	}
+
+	selectors := make([]uint8, groups)
+	mtf := []uint8{0, 1, 2, 3, 4, 5}
+	for g := range selectors {
+		j := 0
+		for {
+			bit, err := r.ReadBit()
+			if err != nil {
+				return io.ErrUnexpectedEOF
+			}
+			if bit == 0 {
+				break
+			}
+			j++
+			if j >= tables {
+				return errors.New("huffman: corrupt selector")
+			}
+		}
+		t := mtf[j]
+		copy(mtf[1:j+1], mtf[:j])
+		mtf[0] = t
+		selectors[g] = t
+	}
+
+	z.buf = z.grow(count)
+	for g, t := range selectors {
+		end := (g + 1) * groupSize
+		if end > len(z.buf) {
+			end = len(z.buf)
+		}
+		err = decodeTables[t].decode(r, z.buf[g*groupSize:end])
+		if err != nil {
+			return err
+		}
+	}
+	err = r.done()
+	if err != nil {
+		return err
+	}
+	z.out = z.buf
+	return nil
+}
@@ -0,0 +1,39 @@
+package Huffman
+
+import (
+	"bytes"
+	"testing"
+)
+
+func encodedSize(t *testing.T, opts Options, data []byte) int {
+	var enc bytes.Buffer
+	err := NewEncoder(opts).Encode(&enc, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return enc.Len()
+}
+
+// Extra tables whose headers cost more than they save are not used. A multi table block with one
+// table only costs the table count and the selectors more than a static block.
+func TestMultiFallback(t *testing.T) {
+	data := make([]byte, 500)
+	for i := range data {
+		data[i] = byte(i % 2)
+	}
+	one := encodedSize(t, Options{Tables: 1}, data) + 1 + (len(data)/groupSize+7)/8
+	for tables := 2; tables <= maxTables; tables++ {
+		if size := encodedSize(t, Options{Tables: tables}, data); size > one {
+			t.Errorf("%d tables: %d bytes, %d with one table", tables, size, one)
+		}
+	}
+}
+
+// Parts of a block with different statistics get their own tables.
+func TestMultiTables(t *testing.T) {
+	data := append(bytes.Repeat([]byte("abcd"), 5000), testData(1, 20000)...)
+	one := encodedSize(t, Options{Tables: 1}, data)
+	if size := encodedSize(t, Options{Tables: 4}, data); size >= one {
+		t.Errorf("4 tables: %d bytes, %d with one table", size, one)
+	}
+}
@@ -0,0 +1,161 @@
+package Huffman
+
+import (
+	ans "compression/ans"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// rANS blocks code the same byte frequencies a static block counts, but with rANS (see package
+// ans) instead of huffman codes, so symbols are not held to a whole number of bits.
+//
+//	count      uint32        number of bytes in the block, 0 marks the end of the stream
+//	precision  uint8         the frequencies add up to 2^precision
+//	freqs      [256]uint16   normalized frequency of each byte value, 0 if it does not occur
+//	size       uint32        number of bytes of encoded data that follow
+//	pad        uint8         always 0
+//
+// Adaptive rANS blocks have no frequencies, the table carries over from the previous block.
+//
+//	count      uint32
+//	precision  uint8         the same in every block
+//	size       uint32
+//	pad        uint8
+const ransHeaderLen = 4 + 1 + 2*256 + 5
+const ransAdaptiveHeaderLen = 4 + 1 + 5
+
+// Fewest bits rANS data can take: the final states of every lane.
+const ransMinBits = 8 * 4 * ans.Lanes
+
+// Most bits rANS data can take for count bytes. Coding a byte moves at most precision bits
+// out of the state, in whole bytes, so at most 2 bytes.
+func ransMaxBits(count uint32) uint64 {
+	return ransMinBits + uint64(count)*16
+}
+
+// Put the block header in front of the coded data.
+func ransBlock(headerLen int, count int, precision int, coded []byte) []byte {
+	data := make([]byte, headerLen, headerLen+len(coded))
+	binary.BigEndian.PutUint32(data, uint32(count))
+	data[4] = uint8(precision)
+	binary.BigEndian.PutUint32(data[headerLen-5:], uint32(len(coded)))
+	return append(data, coded...)
+}
+
+// Count the bytes of block in e.freq, and normalize the counts for package ans.
+func (e *Encoder) normalizedFreqs(block []byte) ([]uint32, error) {
+	for x := range e.freq {
+		delete(e.freq, x)
+	}
+	for _, x := range block {
+		e.freq[x] += 1
+	}
+	counts := make([]int, 256)
+	for x, c := range e.freq {
+		counts[x] = c
+	}
+	return ans.Normalize(counts, uint(e.opts.Precision))
+}
+
+func (e *Encoder) encodeRANSBlock(block []byte) ([]byte, error) {
+	freqs, err := e.normalizedFreqs(block)
+	if err != nil {
+		return nil, err
+	}
+	table, err := ans.NewTable(freqs, uint(e.opts.Precision))
+	if err != nil {
+		return nil, err
+	}
+	coded, err := table.Encode(block)
+	if err != nil {
+		return nil, err
+	}
+	data := ransBlock(ransHeaderLen, len(block), e.opts.Precision, coded)
+	for x, f := range freqs {
+		binary.BigEndian.PutUint16(data[5+2*x:], uint16(f))
+	}
+	return data, nil
+}
+
+func (e *Encoder) encodeRANSAdaptiveBlock(block []byte) ([]byte, error) {
+	if e.model == nil {
+		var err error
+		e.model, err = ans.NewAdaptive(256, uint(e.opts.Precision))
+		if err != nil {
+			return nil, err
+		}
+	}
+	coded, err := e.model.Encode(block)
+	if err != nil {
+		return nil, err
+	}
+	return ransBlock(ransAdaptiveHeaderLen, len(block), e.opts.Precision, coded), nil
+}
+
+// Read the coded data of a rANS block of count bytes.
+func (z *Reader) readRANSData(count uint32) ([]byte, error) {
+	data, pad, err := z.readSizedData(ransMinBits, ransMaxBits(count))
+	if err != nil {
+		return nil, err
+	}
+	if pad != 0 {
+		return nil, errors.New("huffman: corrupt block header")
+	}
+	return data, nil
+}
+
+func (z *Reader) readRANSBlock(count uint32) error {
+	header := make([]byte, 1+2*256)
+	_, err := io.ReadFull(z.r, header)
+	if err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	freqs := make([]uint32, 256)
+	for x := range freqs {
+		freqs[x] = uint32(binary.BigEndian.Uint16(header[1+2*x:]))
+	}
+	table, err := ans.NewTable(freqs, uint(header[0]))
+	if err != nil {
+		return err
+	}
+	data, err := z.readRANSData(count)
+	if err != nil {
+		return err
+	}
+	z.buf = z.grow(count)
+	err = table.Decode(z.buf, data)
+	if err != nil {
+		return err
+	}
+	z.out = z.buf
+	return nil
+}
+
+func (z *Reader) readRANSAdaptiveBlock(count uint32) error {
+	header := make([]byte, 1)
+	_, err := io.ReadFull(z.r, header)
+	if err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	precision := uint(header[0])
+	if z.model == nil {
+		z.model, err = ans.NewAdaptive(256, precision)
+		if err != nil {
+			return err
+		}
+	} else if precision != z.model.Precision() {
+		return errors.New("huffman: corrupt block header")
+	}
+	data, err := z.readRANSData(count)
+	if err != nil {
+		return err
+	}
+	z.buf = z.grow(count)
+	err = z.model.Decode(z.buf, data)
+	if err != nil {
+		return err
+	}
+	z.out = z.buf
+	return nil
+}
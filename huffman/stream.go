@@ -0,0 +1,354 @@
+package Huffman
+
+import (
+	"bufio"
+	"bytes"
+	ans "compression/ans"
+	bitio "compression/bitio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Input is split into blocks of at most BlockSize bytes. Every block gets its own code lengths,
+// so neither the encoder nor the decoder ever has to hold more than one block in memory.
+
+const defaultBlockSize = 1 << 20
+
+// MaxBlockSize is the largest block, in bytes of input. The Reader rejects larger blocks before
+// allocating room for them.
+const MaxBlockSize = 1 << 24
+
+// Header of a single block.
+//
+//	count    uint32      number of bytes in the block, 0 marks the end of the stream
+//	lengths  [256]uint8  code length of each byte value, 0 if the value does not occur in the block
+//	size     uint32      number of bytes of encoded data that follow
+//	pad      uint8       number of zero bits added to fill the last byte of data
+//
+// Every block header ends with size and pad, so the exact number of valid bits is known.
+const blockHeaderLen = 4 + 256 + 5
+
+// MSB first bit writer that packs the codes of a block into memory, after room for its header.
+// Writes to a bytes.Buffer can't fail, so errors are not checked.
+type bitWriter struct {
+	data *bytes.Buffer
+	*bitio.BitWriter
+}
+
+func newBitWriter(headerLen int, size int) *bitWriter {
+	data := bytes.NewBuffer(make([]byte, headerLen, headerLen+size))
+	return &bitWriter{data: data, BitWriter: bitio.NewBitWriter(data, bitio.MSB)}
+}
+
+func (w *bitWriter) writeCode(c code) {
+	w.WriteBits(uint64(c.bits), uint(c.length))
+}
+
+// Write out the last partial byte, padded with zeros, fill in the size and pad fields at the
+// end of the block header, and return the block.
+func (w *bitWriter) finishBlock(headerLen int) []byte {
+	pad, _ := w.Align()
+	w.Flush()
+	data := w.data.Bytes()
+	binary.BigEndian.PutUint32(data[headerLen-5:], uint32(len(data)-headerLen))
+	data[headerLen-1] = uint8(pad)
+	return data
+}
+
+// Writer compresses everything written to it. Close must be called to write the final block.
+type Writer struct {
+	w       io.Writer
+	enc     *Encoder
+	block   []byte
+	err     error
+	started bool
+}
+
+// NewWriter returns a Writer that writes compressed data to w.
+func NewWriter(w io.Writer, opts Options) *Writer {
+	return newWriter(w, NewEncoder(opts))
+}
+
+func newWriter(w io.Writer, enc *Encoder) *Writer {
+	if enc.opts.Adaptive && enc.opts.Coder == CoderHuffman {
+		enc.tree = newAdaptiveTree()
+	}
+	return &Writer{w: w, enc: enc, block: make([]byte, 0, enc.opts.BlockSize)}
+}
+
+func (z *Writer) Write(p []byte) (int, error) {
+	if z.err != nil {
+		return 0, z.err
+	}
+	n := 0
+	for len(p) > 0 {
+		m := z.enc.opts.BlockSize - len(z.block)
+		if m > len(p) {
+			m = len(p)
+		}
+		z.block = append(z.block, p[:m]...)
+		p = p[m:]
+		n += m
+		if len(z.block) == z.enc.opts.BlockSize {
+			z.err = z.writeBlock()
+			if z.err != nil {
+				return n, z.err
+			}
+		}
+	}
+	return n, nil
+}
+
+// Close writes any buffered data and the end of stream marker. It does not close the underlying writer.
+func (z *Writer) Close() error {
+	if z.err != nil {
+		return z.err
+	}
+	if len(z.block) > 0 {
+		z.err = z.writeBlock()
+		if z.err != nil {
+			return z.err
+		}
+	}
+	z.err = z.writeHeader()
+	if z.err != nil {
+		return z.err
+	}
+	_, z.err = z.w.Write(make([]byte, 4))
+	if z.err != nil {
+		return z.err
+	}
+	z.err = errors.New("huffman: writer is closed")
+	return nil
+}
+
+func (z *Writer) writeHeader() error {
+	if z.started {
+		return nil
+	}
+	z.started = true
+	header := make([]byte, 0, len(magic)+2)
+	header = append(header, magic...)
+	header = append(header, version, z.enc.mode())
+	_, err := z.w.Write(header)
+	return err
+}
+
+func (z *Writer) writeBlock() error {
+	err := z.writeHeader()
+	if err != nil {
+		return err
+	}
+	var data []byte
+	switch z.enc.mode() {
+	case modeAdaptive:
+		data = z.enc.encodeAdaptiveBlock(z.block)
+	case modeMulti:
+		data, err = z.enc.encodeMultiBlock(z.block)
+	case modeRANS:
+		data, err = z.enc.encodeRANSBlock(z.block)
+	case modeRANSAdaptive:
+		data, err = z.enc.encodeRANSAdaptiveBlock(z.block)
+	case modeTANS:
+		data, err = z.enc.encodeTANSBlock(z.block)
+	default:
+		data, err = z.enc.encodeBlock(z.block)
+	}
+	if err != nil {
+		return err
+	}
+	z.block = z.block[:0]
+	_, err = z.w.Write(data)
+	return err
+}
+
+// Encode one block, including its header.
+func (e *Encoder) encodeBlock(block []byte) ([]byte, error) {
+	for x := range e.freq {
+		delete(e.freq, x)
+	}
+	for _, x := range block {
+		e.freq[x] += 1
+	}
+	lengths, err := buildLengths(e.freq, e.opts)
+	if err != nil {
+		return nil, err
+	}
+	canonicalDict(&lengths, &e.dict)
+	w := newBitWriter(blockHeaderLen, len(block))
+	for _, x := range block {
+		w.writeCode(e.dict[x])
+	}
+	data := w.finishBlock(blockHeaderLen)
+	binary.BigEndian.PutUint32(data, uint32(len(block)))
+	copy(data[4:], lengths[:])
+	return data, nil
+}
+
+// Reader decompresses a stream written by Writer.
+type Reader struct {
+	r       *bufio.Reader
+	mode    byte
+	tree    *adaptiveTree
+	model   *ans.Adaptive
+	buf     []byte
+	out     []byte
+	err     error
+	started bool
+}
+
+// NewReader returns a Reader that reads compressed data from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+func (z *Reader) Read(p []byte) (int, error) {
+	for len(z.out) == 0 {
+		if z.err != nil {
+			return 0, z.err
+		}
+		z.err = z.readBlock()
+	}
+	n := copy(p, z.out)
+	z.out = z.out[n:]
+	return n, nil
+}
+
+func (z *Reader) readHeader() error {
+	header := make([]byte, len(magic)+2)
+	_, err := io.ReadFull(z.r, header)
+	if err != nil || string(header[:len(magic)]) != string(magic) {
+		return errors.New("huffman: not a huffman file")
+	}
+	if header[len(magic)] != version {
+		return fmt.Errorf("huffman: unsupported version %d", header[len(magic)])
+	}
+	z.mode = header[len(magic)+1]
+	switch z.mode {
+	case modeStatic, modeMulti, modeRANS, modeRANSAdaptive, modeTANS:
+	case modeAdaptive:
+		z.tree = newAdaptiveTree()
+	default:
+		return fmt.Errorf("huffman: unknown mode %d", z.mode)
+	}
+	return nil
+}
+
+// Read and decode the next block into z.out. Returns io.EOF at the end of the stream.
+func (z *Reader) readBlock() error {
+	if !z.started {
+		z.started = true
+		err := z.readHeader()
+		if err != nil {
+			return err
+		}
+	}
+	header := make([]byte, blockHeaderLen)
+	_, err := io.ReadFull(z.r, header[:4])
+	if err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	count := binary.BigEndian.Uint32(header)
+	if count == 0 {
+		return io.EOF
+	}
+	if count > MaxBlockSize {
+		return errors.New("huffman: corrupt block header")
+	}
+	switch z.mode {
+	case modeAdaptive:
+		return z.readAdaptiveBlock(count)
+	case modeMulti:
+		return z.readMultiBlock(count)
+	case modeRANS:
+		return z.readRANSBlock(count)
+	case modeRANSAdaptive:
+		return z.readRANSAdaptiveBlock(count)
+	case modeTANS:
+		return z.readTANSBlock(count)
+	}
+	_, err = io.ReadFull(z.r, header[4:4+256])
+	if err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	var lengths [256]uint8
+	copy(lengths[:], header[4:])
+	table, err := newDecodeTable(&lengths)
+	if err != nil {
+		return err
+	}
+	// Every symbol takes at least one bit, and at most maxDecodeLen.
+	r, err := z.readData(uint64(count), uint64(count)*maxDecodeLen)
+	if err != nil {
+		return err
+	}
+	z.buf = z.grow(count)
+	err = table.decode(r, z.buf)
+	if err != nil {
+		return err
+	}
+	err = r.done()
+	if err != nil {
+		return err
+	}
+	z.out = z.buf
+	return nil
+}
+
+// Read the encoded data of a block, for reading bits from.
+func (z *Reader) readData(minBits uint64, maxBits uint64) (*blockReader, error) {
+	data, pad, err := z.readSizedData(minBits, maxBits)
+	if err != nil {
+		return nil, err
+	}
+	return newBlockReader(data, pad), nil
+}
+
+// Read the size and pad fields at the end of a block header, and the encoded data that follows.
+// minBits and maxBits are the fewest and the most bits the block could have been coded in.
+func (z *Reader) readSizedData(minBits uint64, maxBits uint64) ([]byte, uint8, error) {
+	header := make([]byte, 5)
+	_, err := io.ReadFull(z.r, header)
+	if err != nil {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	size := binary.BigEndian.Uint32(header)
+	pad := header[4]
+	bits := uint64(size)*8 - uint64(pad)
+	if pad > 7 || (size == 0 && pad > 0) || bits < minBits || bits > maxBits {
+		return nil, 0, errors.New("huffman: corrupt block header")
+	}
+	data := make([]byte, size)
+	_, err = io.ReadFull(z.r, data)
+	if err != nil {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	return data, pad, nil
+}
+
+func (z *Reader) readAdaptiveBlock(count uint32) error {
+	r, err := z.readData(uint64(count), uint64(count)*maxAdaptiveBits)
+	if err != nil {
+		return err
+	}
+	z.buf = z.grow(count)
+	err = z.tree.decode(r, z.buf)
+	if err != nil {
+		return err
+	}
+	err = r.done()
+	if err != nil {
+		return err
+	}
+	z.out = z.buf
+	return nil
+}
+
+func (z *Reader) grow(count uint32) []byte {
+	if cap(z.buf) < int(count) {
+		return make([]byte, count)
+	}
+	return z.buf[:count]
+}
@@ -0,0 +1,74 @@
+package Huffman
+
+import (
+	ans "compression/ans"
+	"encoding/binary"
+)
+
+// tANS blocks code the same byte frequencies a static block counts with tANS (see package ans),
+// which decodes with one table lookup per byte like huffman codes, but without rounding every
+// symbol to a whole number of bits. The normalized frequencies are part of the data.
+//
+//	count    uint32  number of bytes in the block, 0 marks the end of the stream
+//	size     uint32  number of bytes of encoded data that follow
+//	pad      uint8   number of zero bits added to fill the last byte of data
+//	data             frequencies (see ans.WriteCounts), then the bytes coded by ans.FSE
+const tansHeaderLen = 4 + 5
+
+// Fewest bits tANS data can take: the precision and the first frequency, and the final state.
+const tansMinBits = 5 + ans.MinPrecision + 1 + ans.MinPrecision
+
+// Most bits tANS data can take for count bytes: every frequency, with a run of zeros after it,
+// the final state, and at most precision bits per byte.
+func tansMaxBits(count uint32) uint64 {
+	return 5 + 256*(ans.MaxPrecision+1+2) + ans.MaxPrecision + uint64(count)*ans.MaxPrecision
+}
+
+func (e *Encoder) encodeTANSBlock(block []byte) ([]byte, error) {
+	freqs, err := e.normalizedFreqs(block)
+	if err != nil {
+		return nil, err
+	}
+	table, err := ans.NewFSE(freqs, uint(e.opts.Precision))
+	if err != nil {
+		return nil, err
+	}
+	w := newBitWriter(tansHeaderLen, len(block))
+	err = ans.WriteCounts(w.BitWriter, freqs, table.Precision())
+	if err != nil {
+		return nil, err
+	}
+	err = table.Encode(w.BitWriter, block)
+	if err != nil {
+		return nil, err
+	}
+	data := w.finishBlock(tansHeaderLen)
+	binary.BigEndian.PutUint32(data, uint32(len(block)))
+	return data, nil
+}
+
+func (z *Reader) readTANSBlock(count uint32) error {
+	r, err := z.readData(tansMinBits, tansMaxBits(count))
+	if err != nil {
+		return err
+	}
+	freqs, precision, err := ans.ReadCounts(r.BitReader, 256)
+	if err != nil {
+		return err
+	}
+	table, err := ans.NewFSE(freqs, precision)
+	if err != nil {
+		return err
+	}
+	z.buf = z.grow(count)
+	err = table.Decode(r.BitReader, z.buf)
+	if err != nil {
+		return err
+	}
+	err = r.done()
+	if err != nil {
+		return err
+	}
+	z.out = z.buf
+	return nil
+}
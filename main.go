@@ -1,9 +1,17 @@
 package main
 
 import (
-	backup "compression/backup"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	counter "compression/counter"
 	ctw "compression/ctw"
 	Huffman "compression/huffman"
+	ops "compression/ops"
 )
 
 var filepath = "enwik8"
@@ -16,14 +24,148 @@ var alg = "ctw"
 func main() {
 	if alg == "huffman" {
 		Huffman.HuffMain(filepath, outPath)
+		err := Huffman.Decode(outPath, outOutPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if alg == "huffman-adaptive" {
+		opts := Huffman.DefaultOptions
+		opts.Adaptive = true
+		Huffman.HuffMainOptions(filepath, outPath, opts)
+	}
+	if alg == "huffman-rans" {
+		opts := Huffman.DefaultOptions
+		opts.Coder = Huffman.CoderRANS
+		Huffman.HuffMainOptions(filepath, outPath, opts)
+	}
+	if alg == "huffman-compare" {
+		fmt.Println("coder         |      bytes | encode MB/s | decode MB/s")
+		for _, c := range []struct {
+			name string
+			opts Huffman.Options
+		}{
+			{"huffman", Huffman.DefaultOptions},
+			{"rans", Huffman.Options{Coder: Huffman.CoderRANS}},
+			{"rans-16", Huffman.Options{Coder: Huffman.CoderRANS, Precision: 16}},
+			{"tans", Huffman.Options{Coder: Huffman.CoderTANS}},
+			{"tans-12", Huffman.Options{Coder: Huffman.CoderTANS, Precision: 12}},
+			{"adaptive", Huffman.Options{Adaptive: true}},
+			{"rans-adaptive", Huffman.Options{Coder: Huffman.CoderRANS, Adaptive: true}},
+		} {
+			compareMain(c.name, c.opts)
+		}
 	}
 	if alg == "ctw" {
 		ctw.Encode(filepath, outPath)
-		//fmt.Println("DECODING NOW")
-		//ctw.Decode(outPath, outOutPath)
+		fmt.Println("DECODING NOW")
+		ctw.Decode(outPath, outOutPath)
+	}
+	if alg == "cts" {
+		ctw.EncodeOptions(filepath, outPath, ctw.Options{Depth: ctw.Depth, Switching: true})
+		fmt.Println("DECODING NOW")
+		ctw.Decode(outPath, outOutPath)
+	}
+	if alg == "ctw-depths" {
+		fmt.Println("depth | bits per byte | byte model | byte model cts")
+		// 2^24 nodes in a hash table, so the deep contexts of a large file fit in memory.
+		for _, depth := range []int{8, 16, 24, 32, 48} {
+			bits := ctw.BitsPerByte(filepath, ctw.Options{Depth: depth, HashBits: 24})
+			bytes := ctw.BitsPerByte(filepath, ctw.Options{Depth: depth, HashBits: 24, Bytes: true})
+			cts := ctw.BitsPerByte(filepath, ctw.Options{Depth: depth, HashBits: 24, Bytes: true, Switching: true})
+			fmt.Printf("%5d | %13.4f | %10.4f | %14.4f\n", depth, bits, bytes, cts)
+		}
+	}
+	if alg == "counter" {
+		predictorMain(func() ops.Predictor {
+			m, err := counter.New(2, 22)
+			if err != nil {
+				log.Fatal(err)
+			}
+			return m
+		})
+	}
+	if alg == "range" {
+		codecMain(func(w io.Writer, r io.Reader) (int64, error) {
+			return ops.EncodeBytesRange(w, r, 2)
+		}, func(w io.Writer, r io.Reader, n int64) error {
+			return ops.DecodeBytesRange(w, r, 2, n)
+		})
+	}
+	if alg == "ctw-backends" {
+		fmt.Println("backend | bits per byte")
+		for _, b := range []ctw.Backend{ctw.BackendLog, ctw.BackendFloat, ctw.BackendBig} {
+			fmt.Printf("%7d | %.4f\n", b, ctw.BitsPerByte(filepath, ctw.Options{Depth: ctw.Depth, Backend: b}))
+		}
+	}
+}
+
+// Code filepath with the models returned by newModel through ops.EncodeBytes, decode it again,
+// and check that it comes back the same. The output has no header, so it can only be decoded here.
+func predictorMain(newModel func() ops.Predictor) {
+	codecMain(func(w io.Writer, r io.Reader) (int64, error) {
+		return ops.EncodeBytes(w, r, newModel())
+	}, func(w io.Writer, r io.Reader, n int64) error {
+		return ops.DecodeBytes(w, r, newModel(), n)
+	})
+}
+
+// Code filepath with encode, decode it again with decode, and check that it comes back the same.
+// encode returns the number of bytes it read, which decode is given.
+func codecMain(encode func(io.Writer, io.Reader) (int64, error), decode func(io.Writer, io.Reader, int64) error) {
+	data, err := os.ReadFile(filepath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Bytes: ", len(data))
+	var enc bytes.Buffer
+	n, err := encode(&enc, bytes.NewReader(data))
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Compressed Bytes: ", enc.Len())
+	err = os.WriteFile(outPath, enc.Bytes(), 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println("DECODING NOW")
+	var dec bytes.Buffer
+	err = decode(&dec, bytes.NewReader(enc.Bytes()), n)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = os.WriteFile(outOutPath, dec.Bytes(), 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !bytes.Equal(data, dec.Bytes()) {
+		log.Fatal("decoded data does not match original")
+	}
+}
 
+// Encode and decode filepath with opts, and print the compressed size and how fast each way was.
+func compareMain(name string, opts Huffman.Options) {
+	info, err := os.Stat(filepath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	mb := float64(info.Size()) / (1 << 20)
+	start := time.Now()
+	err = Huffman.EncodeOptions(filepath, outPath, opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	encode := time.Since(start)
+	start = time.Now()
+	err = Huffman.Decode(outPath, outOutPath)
+	if err != nil {
+		log.Fatal(err)
 	}
-	if alg == "backup" {
-		backup.Encode(filepath, outPath)
+	decode := time.Since(start)
+	info, err = os.Stat(outPath)
+	if err != nil {
+		log.Fatal(err)
 	}
+	fmt.Printf("%-13s | %10d | %11.1f | %11.1f\n", name, info.Size(), mb/encode.Seconds(), mb/decode.Seconds())
 }
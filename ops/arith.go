@@ -0,0 +1,188 @@
+package ops
+
+import (
+	bitio "compression/bitio"
+	"io"
+)
+
+// Binary arithmetic coder with 32 bit low/high registers.
+// Based on Witten, Neal and Cleary, "Arithmetic coding for data compression" (1987).
+//
+// The interval [low, high] starts as the whole 32 bit range. For every bit, it is split in two
+// with the size of each part proportional to its probability, and the part for the bit that was
+// seen becomes the new interval. Whenever the interval fits in one half of the range, the top bit
+// of every number in it is known, so it is written out and the interval is doubled (E1/E2).
+// When the interval straddles the middle but fits in the middle half, the next bit is not known
+// yet, so it is counted as pending and the interval is doubled around the middle (E3).
+// Pending bits are written as the opposite of the next known bit.
+
+const (
+	codeBits = 32
+	top      = uint64(1)<<codeBits - 1
+	half     = uint64(1) << (codeBits - 1)
+	quarter  = uint64(1) << (codeBits - 2)
+)
+
+// ProbBits is the precision of the probabilities given to the coder.
+// A probability p means p/2^ProbBits, and must be in [1, 2^ProbBits-1].
+const ProbBits = 16
+
+// Keep a probability from being 0 or 1, which would leave one of the bits with no interval.
+func clampProb(p1 uint16) uint64 {
+	if p1 == 0 {
+		return 1
+	}
+	return uint64(p1)
+}
+
+// Split [low, high] into the interval for 0, [low, split], and the interval for 1, [split+1, high].
+func split(low uint64, high uint64, p1 uint16) uint64 {
+	rng := high - low + 1
+	p0 := uint64(1)<<ProbBits - clampProb(p1)
+	return low + (rng*p0)>>ProbBits - 1
+}
+
+// ArithEncoder codes bits with given probabilities and writes the result to an io.Writer.
+type ArithEncoder struct {
+	low     uint64
+	high    uint64
+	pending int
+	out     *bitio.BitWriter
+}
+
+// NewArithEncoder returns an ArithEncoder that writes to w. Nothing is written before Flush,
+// or before a few KB of output have built up.
+func NewArithEncoder(w io.Writer) *ArithEncoder {
+	return &ArithEncoder{high: top, out: bitio.NewBitWriter(w, bitio.MSB)}
+}
+
+// Write a known bit, followed by any pending bits.
+func (e *ArithEncoder) emit(bit uint8) error {
+	err := e.out.WriteBit(bit)
+	for ; e.pending > 0 && err == nil; e.pending-- {
+		err = e.out.WriteBit(bit ^ 1)
+	}
+	return err
+}
+
+// Encode codes bit, where p1 is the probability that bit is 1 (see ProbBits).
+func (e *ArithEncoder) Encode(bit uint8, p1 uint16) error {
+	s := split(e.low, e.high, p1)
+	if bit == 0 {
+		e.high = s
+	} else {
+		e.low = s + 1
+	}
+	for {
+		switch {
+		case e.high < half:
+			// E1: both in the lower half
+			err := e.emit(0)
+			if err != nil {
+				return err
+			}
+		case e.low >= half:
+			// E2: both in the upper half
+			err := e.emit(1)
+			if err != nil {
+				return err
+			}
+			e.low -= half
+			e.high -= half
+		case e.low >= quarter && e.high < 3*quarter:
+			// E3: straddling the middle
+			e.pending++
+			e.low -= quarter
+			e.high -= quarter
+		default:
+			return nil
+		}
+		e.low <<= 1
+		e.high = e.high<<1 | 1
+	}
+}
+
+// Flush writes enough bits to pick out a number inside the final interval, padded with zeros
+// to a whole byte. The decoder reads zeros past the end of the data, so two bits (plus pending
+// bits) are enough.
+func (e *ArithEncoder) Flush() error {
+	e.pending++
+	var err error
+	if e.low < quarter {
+		err = e.emit(0)
+	} else {
+		err = e.emit(1)
+	}
+	if err != nil {
+		return err
+	}
+	return e.out.Flush()
+}
+
+// ArithDecoder reads bits written by ArithEncoder. It must be given the same probabilities,
+// in the same order, that the encoder was given.
+type ArithDecoder struct {
+	low   uint64
+	high  uint64
+	value uint64
+	in    *bitio.BitReader
+}
+
+// NewArithDecoder returns an ArithDecoder that reads from r.
+// The decoder keeps codeBits bits of data ahead, and Flush only writes a few bits past the
+// interval, so it reads up to 4 bytes more than the coded data. The coded data should be the
+// last thing in r.
+func NewArithDecoder(r io.Reader) (*ArithDecoder, error) {
+	d := &ArithDecoder{high: top, in: bitio.NewBitReader(r, bitio.MSB)}
+	for i := 0; i < codeBits; i++ {
+		bit, err := d.readBit()
+		if err != nil {
+			return nil, err
+		}
+		d.value = d.value<<1 | bit
+	}
+	return d, nil
+}
+
+// Read the next bit of coded data. Reading past the end of the data gives zeros.
+func (d *ArithDecoder) readBit() (uint64, error) {
+	bit, err := d.in.ReadBit()
+	if err == io.EOF {
+		return 0, nil
+	}
+	return uint64(bit), err
+}
+
+// Decode returns the next bit, where p1 is the probability that it is 1 (see ProbBits).
+func (d *ArithDecoder) Decode(p1 uint16) (uint8, error) {
+	s := split(d.low, d.high, p1)
+	bit := uint8(0)
+	if d.value <= s {
+		d.high = s
+	} else {
+		bit = 1
+		d.low = s + 1
+	}
+	for {
+		switch {
+		case d.high < half:
+		case d.low >= half:
+			d.low -= half
+			d.high -= half
+			d.value -= half
+		case d.low >= quarter && d.high < 3*quarter:
+			d.low -= quarter
+			d.high -= quarter
+			d.value -= quarter
+		default:
+			return bit, nil
+		}
+		d.low <<= 1
+		d.high = d.high<<1 | 1
+		next, err := d.readBit()
+		if err != nil {
+			return 0, err
+		}
+		d.value = d.value<<1 | next
+	}
+}
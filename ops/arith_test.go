@@ -0,0 +1,135 @@
+package ops
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+const maxProb = 1<<ProbBits - 1
+
+// Codes bits with probs and decodes them again. Returns the longest run of pending bits the
+// encoder saw, and whether Flush found low below a quarter.
+func arithRoundTrip(t *testing.T, name string, bits []uint8, probs []uint16) (int, bool) {
+	var buf bytes.Buffer
+	enc := NewArithEncoder(&buf)
+	pending := 0
+	for i, bit := range bits {
+		if err := enc.Encode(bit, probs[i]); err != nil {
+			t.Fatal(err)
+		}
+		if enc.pending > pending {
+			pending = enc.pending
+		}
+	}
+	low := enc.low < quarter
+	if err := enc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	dec, err := NewArithDecoder(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range bits {
+		bit, err := dec.Decode(probs[i])
+		if err != nil || bit != want {
+			t.Fatalf("%s: bit %d is %d, %v, want %d", name, i, bit, err, want)
+		}
+	}
+	return pending, low
+}
+
+// Random bits, both independent of their probabilities and drawn from them, with probabilities
+// anywhere in the range, including 0 (taken as 1) and the largest one.
+func TestArithRandom(t *testing.T) {
+	for seed := int64(1); seed <= 5; seed++ {
+		r := rand.New(rand.NewSource(seed))
+		bits := make([]uint8, 20000)
+		probs := make([]uint16, len(bits))
+		for i := range bits {
+			switch r.Intn(4) {
+			case 0:
+				probs[i] = uint16(r.Intn(maxProb + 1))
+			case 1:
+				probs[i] = []uint16{0, 1, maxProb - 1, maxProb}[r.Intn(4)]
+			default:
+				probs[i] = uint16(r.Intn(1 << 8))
+				if r.Intn(2) == 0 {
+					probs[i] = maxProb - probs[i]
+				}
+			}
+			if r.Intn(2) == 0 {
+				bits[i] = uint8(r.Intn(2))
+			} else if r.Intn(1<<ProbBits) < int(probs[i]) {
+				bits[i] = 1
+			}
+		}
+		arithRoundTrip(t, "random", bits, probs)
+	}
+}
+
+// Every bit is the unlikely one, at the most extreme probabilities.
+func TestArithExtreme(t *testing.T) {
+	for _, p := range []uint16{0, 1, maxProb} {
+		for _, bit := range []uint8{0, 1} {
+			bits := make([]uint8, 1000)
+			probs := make([]uint16, len(bits))
+			for i := range bits {
+				bits[i] = bit
+				probs[i] = p
+			}
+			arithRoundTrip(t, "extreme", bits, probs)
+		}
+	}
+}
+
+// Each bit cuts the interval down to inside the middle half, while it still straddles the
+// middle: a 0 when high is above 3/4, else a 1. Every pair of bits adds a pending bit.
+func TestArithPending(t *testing.T) {
+	bits := make([]uint8, 2000)
+	probs := make([]uint16, len(bits))
+	enc := NewArithEncoder(&bytes.Buffer{})
+	for i := range bits {
+		rng := enc.high - enc.low + 1
+		if enc.high >= 3*quarter {
+			p0 := (3*quarter - enc.low) << ProbBits / rng
+			probs[i] = uint16(1<<ProbBits - p0)
+		} else {
+			p0 := ((quarter-enc.low)<<ProbBits + rng - 1) / rng
+			bits[i] = 1
+			probs[i] = uint16(1<<ProbBits - p0)
+		}
+		enc.Encode(bits[i], probs[i])
+	}
+	pending, _ := arithRoundTrip(t, "pending", bits, probs)
+	if pending < 900 {
+		t.Errorf("longest run of pending bits is %d", pending)
+	}
+	// End in the middle of a run, and with a bit that leaves it pending.
+	for _, n := range []int{1, 2, 3, 501, 1000} {
+		arithRoundTrip(t, "pending", bits[:n], probs[:n])
+	}
+}
+
+// Short inputs, so that Flush ends both below and above a quarter.
+func TestArithFlush(t *testing.T) {
+	seen := [2]bool{}
+	r := rand.New(rand.NewSource(1))
+	for n := 0; n < 2000; n++ {
+		bits := make([]uint8, n%20)
+		probs := make([]uint16, len(bits))
+		for i := range bits {
+			bits[i] = uint8(r.Intn(2))
+			probs[i] = uint16(r.Intn(maxProb + 1))
+		}
+		_, low := arithRoundTrip(t, "flush", bits, probs)
+		if low {
+			seen[0] = true
+		} else {
+			seen[1] = true
+		}
+	}
+	if !seen[0] || !seen[1] {
+		t.Errorf("Flush ended below a quarter: %v, above: %v", seen[0], seen[1])
+	}
+}
@@ -1,96 +1,99 @@
 package ops
 
 import (
+	"fmt"
 	"math/big"
 )
 
-// lower, split, upper, interval [a,b]
-// l *big.Float, s *big.Float, u *big.Float,
+// Binary_expansion appends to ret the shortest string of bits s such that the dyadic interval
+// [0.s, 0.s + 2^-len(s)) lies inside [a,b), and returns it. 0 <= a < b <= 1.
+// a and b are not changed.
+//
+// It works like ops.ArithEncoder: while the interval fits in one half, the next bit is known, so it
+// is emitted and the interval is doubled. While it straddles 1/2 but fits in [1/4,3/4), the next
+// bit is not known yet, so it is counted as pending and the interval is doubled around 1/2.
+// Pending bits are emitted as the opposite of the next known bit.
 func Binary_expansion(a *big.Float, b *big.Float, ret []uint8) []uint8 {
-	// a is lower bound of target interval
-	// b is upper bound of target interval
-	// |----0----|----1----|
-	// 0.0       0.5       1.0
-	//
-	//fmt.Println(a, b)
-	switch {
-	case a.Cmp(big.NewFloat(0.5)) == 1:
-		// |----0----|----1-[]-|
-		// 0.0       0.5    ab 1.0
-		// If a > 1/2:
-		//     emit 1
-		//     a,b = 2(a,b - 1/2)
-		ret = append(ret, 1)
-		return Binary_expansion(big.NewFloat(1).Mul(big.NewFloat(1).Add(a, big.NewFloat(-0.5)), big.NewFloat(2.0)), big.NewFloat(1).Mul(big.NewFloat(1).Add(b, big.NewFloat(-0.5)), big.NewFloat(2.0)), ret)
-	case b.Cmp(big.NewFloat(0.5)) == -1:
-		// |----0-[]-|----1----|
-		// 0.0    ab 0.5       1.0
-		// If b < 1/2:
-		//     emit 0
-		//     a,b = 2(a,b)
-		ret = append(ret, 0)
-		return Binary_expansion(big.NewFloat(1).Mul(a, big.NewFloat(2.0)), big.NewFloat(1).Mul(b, big.NewFloat(2.0)), ret)
-	default:
-		// |----0--[ |  ]-1----|
-		// 0.0     a 0.5 b      1.0
-		return special_case(a, b, ret)
+	if a.Sign() < 0 || b.Cmp(bigOne) > 0 || a.Cmp(b) >= 0 {
+		panic(fmt.Sprintf("ops: Binary_expansion of [%v, %v)", a, b))
+	}
+	// Work on copies, doubling is exact.
+	lo := new(big.Float).Copy(a)
+	hi := new(big.Float).Copy(b)
+	pending := 0
+	emit := func(bit uint8) {
+		ret = append(ret, bit)
+		for ; pending > 0; pending-- {
+			ret = append(ret, bit^1)
+		}
+	}
+	for {
+		switch {
+		case hi.Cmp(bigHalf) <= 0:
+			// |----0-[]-|----1----|
+			// 0.0    ab 0.5       1.0
+			emit(0)
+		case lo.Cmp(bigHalf) >= 0:
+			// |----0----|----1-[]-|
+			// 0.0       0.5    ab 1.0
+			emit(1)
+			lo.Sub(lo, bigHalf)
+			hi.Sub(hi, bigHalf)
+		case lo.Cmp(bigQuarter) >= 0 && hi.Cmp(bigThreeQuarters) <= 0:
+			// |----0---[|]---1----|
+			// 0.0     a 0.5 b     1.0
+			// Either 01 or 10 is next, a pending bit.
+			pending++
+			lo.Sub(lo, bigQuarter)
+			hi.Sub(hi, bigQuarter)
+		default:
+			// |----0--[-|---]-1----|
+			// 0.0     a 0.5  b     1.0
+			// [a,b) holds all of [1/4,1/2) or [1/2,3/4), so at most two more bits are needed.
+			switch {
+			case pending == 0 && lo.Sign() <= 0 && hi.Cmp(bigOne) >= 0:
+				// [0,1) itself.
+			case lo.Sign() <= 0:
+				emit(0)
+			case hi.Cmp(bigOne) >= 0:
+				emit(1)
+			case lo.Cmp(bigQuarter) <= 0:
+				emit(0)
+				ret = append(ret, 1)
+			default:
+				emit(1)
+				ret = append(ret, 0)
+			}
+			return ret
+		}
+		lo.Mul(lo, bigTwo)
+		hi.Mul(hi, bigTwo)
 	}
 }
 
-// type block struct {
-// 	low  *big.Float //inclusive
-// 	high *big.Float //not inclusive
-// 	bit  uint8
-// }
-
-func special_case(a *big.Float, b *big.Float, ret []uint8) []uint8 {
-	//recurse here
-
-	//INCOMPLETE - need to adjust block sizes, adjust a and b based on contained blocks, and keep track of what to return.
+var (
+	bigOne           = big.NewFloat(1)
+	bigTwo           = big.NewFloat(2)
+	bigHalf          = big.NewFloat(0.5)
+	bigQuarter       = big.NewFloat(0.25)
+	bigThreeQuarters = big.NewFloat(0.75)
+)
 
-	// |----00----|----01----|----10----|----11----|
-	// 0.0        0.25       0.5        0.75       1.0
-	//
-	// blocks := []block{{big.NewFloat(0), big.NewFloat(0.25), 0}, {big.NewFloat(0.25), big.NewFloat(0.5), 0}, {big.NewFloat(0.5), big.NewFloat(0.75), 1}, {big.NewFloat(0.75), big.NewFloat(1), 1}}
-	// contained := make([]block, 4)
-	// for _, x := range blocks {
-	// 	switch {
-	// 	case a.Cmp(x.high) >= 0 || b.Cmp(x.low) < 0:
-	// 		continue
-	// 	default:
-	// 		contained = append(contained, x)
-	// 	}
-	// }
-	// for {
-	// }
-	switch {
-	case a.Cmp(big.NewFloat(0.25)) <= 0 && b.Cmp(big.NewFloat(0.75)) > 0:
-		// both 01 and 10 are in the interval [a,b), so either one can be used.
-		ret = append(ret, 0)
-		ret = append(ret, 1)
-		return ret
-	case a.Cmp(big.NewFloat(0.25)) > 0 && b.Cmp(big.NewFloat(0.75)) >= 0:
-		// only 10 is fully within the interval [a,b).
-		ret = append(ret, 1)
-		ret = append(ret, 0)
-		return ret
-	case a.Cmp(big.NewFloat(0.25)) <= 0 && b.Cmp(big.NewFloat(0.75)) < 0:
-		// only 01 is fully within the interval [a,b).
-		ret = append(ret, 0)
-		ret = append(ret, 1)
-		return ret
-	default:
-		// neither 01 nor 10 are fully within the interval [a,b), so we scale both of them up and try again.
-		a.Add(a, big.NewFloat(-0.25))
-		b.Add(b, big.NewFloat(0.25))
-		ret = append(ret, 2) // Add a placeholder
-		placeholder := len(ret) - 1
-		ret = special_case(a, b, ret)
-		if ret[placeholder+1] == 1 {
-			ret[placeholder] = 0
-		} else if ret[placeholder+1] == 0 {
-			ret[placeholder] = 1
+// Binary_interval is the inverse of Binary_expansion: it returns the dyadic interval
+// [0.bits, 0.bits + 2^-len(bits)) picked out by bits.
+func Binary_interval(bits []uint8) (*big.Float, *big.Float) {
+	prec := uint(len(bits) + 2)
+	if prec < 53 {
+		prec = 53
+	}
+	lo := new(big.Float).SetPrec(prec)
+	step := new(big.Float).SetPrec(prec).SetInt64(1)
+	for _, bit := range bits {
+		step.Quo(step, bigTwo)
+		if bit != 0 {
+			lo.Add(lo, step)
 		}
-		return ret
 	}
+	hi := new(big.Float).SetPrec(prec).Add(lo, step)
+	return lo, hi
 }
@@ -0,0 +1,88 @@
+package ops
+
+import (
+	"math/big"
+	"math/rand"
+	"testing"
+)
+
+// Length of the shortest code for [a,b), by trying every length in turn.
+func shortestLength(a *big.Float, b *big.Float) int {
+	for k := 0; ; k++ {
+		scale := new(big.Float).SetMantExp(big.NewFloat(1), k)
+		m, acc := new(big.Float).Mul(a, scale).Int(nil)
+		if acc == big.Below {
+			m.Add(m, big.NewInt(1))
+		}
+		end := new(big.Float).SetInt(m.Add(m, big.NewInt(1)))
+		if end.Cmp(new(big.Float).Mul(b, scale)) <= 0 {
+			return k
+		}
+	}
+}
+
+// The code's interval is inside [a,b), no shorter code exists, a and b are unchanged,
+// and Binary_interval gives the code back.
+func checkExpansion(t *testing.T, x float64, y float64) []uint8 {
+	a := big.NewFloat(x)
+	b := big.NewFloat(y)
+	bits := Binary_expansion(a, b, nil)
+	lo, hi := Binary_interval(bits)
+	switch {
+	case a.Cmp(big.NewFloat(x)) != 0 || b.Cmp(big.NewFloat(y)) != 0:
+		t.Errorf("[%v, %v): input changed", x, y)
+	case lo.Cmp(a) < 0 || hi.Cmp(b) > 0:
+		t.Errorf("[%v, %v): code %v is outside", x, y, bits)
+	case len(bits) != shortestLength(a, b):
+		t.Errorf("[%v, %v): code %v, shortest has %d bits", x, y, bits, shortestLength(a, b))
+	}
+	if again := Binary_expansion(lo, hi, nil); string(again) != string(bits) {
+		t.Errorf("[%v, %v): code %v, of its own interval %v", x, y, bits, again)
+	}
+	return bits
+}
+
+func TestExpansionEdges(t *testing.T) {
+	tests := []struct {
+		a, b float64
+		bits string
+	}{
+		{0, 1, ""},
+		{0, 0.5, "\x00"},
+		{0.5, 1, "\x01"},
+		{0, 0.75, "\x00"},
+		{0.25, 1, "\x01"},
+		{0.25, 0.5, "\x00\x01"},
+	}
+	for _, test := range tests {
+		if bits := checkExpansion(t, test.a, test.b); string(bits) != test.bits {
+			t.Errorf("[%v, %v): code %v", test.a, test.b, bits)
+		}
+	}
+	// [1/4,3/4) straddles 1/2, so it takes a pending bit and a code of 2 bits.
+	if bits := checkExpansion(t, 0.25, 0.75); len(bits) != 2 {
+		t.Errorf("[0.25, 0.75): code %v", bits)
+	}
+	// The code is appended to ret.
+	if bits := Binary_expansion(big.NewFloat(0.5), bigOne, []uint8{1, 0}); string(bits) != "\x01\x00\x01" {
+		t.Errorf("appended code %v", bits)
+	}
+}
+
+// Random intervals of all sizes.
+func TestExpansion(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 5000; i++ {
+		x := r.Float64()
+		y := x + r.Float64()*(1-x)*float64(r.Int63n(2)+1)/2/float64(int64(1)<<r.Intn(40))
+		if i%10 == 0 {
+			// Intervals around 1/2, which need pending bits.
+			x = 0.5 - r.Float64()/float64(int64(1)<<r.Intn(40))
+			y = 0.5 + r.Float64()/float64(int64(1)<<r.Intn(40))
+		}
+		if x < 0 || !(x < y) || y > 1 {
+			continue
+		}
+		checkExpansion(t, x, y)
+	}
+}
@@ -0,0 +1,59 @@
+package ops
+
+import (
+	bitio "compression/bitio"
+	"io"
+)
+
+// Predictor is a model of a stream of bits. Models only have to say how likely the next bit is
+// and learn from the bit that was seen; EncodeBytes and DecodeBytes do the coding.
+type Predictor interface {
+	// P1 is the probability that the next bit is 1 (see ProbBits).
+	P1() uint16
+	// Update gives the model the bit that was coded.
+	Update(bit uint8)
+}
+
+// EncodeBytes codes every byte read from r, MSB first, with the probabilities from p, and writes
+// the result to w. It returns the number of bytes read, which DecodeBytes needs to stop.
+func EncodeBytes(w io.Writer, r io.Reader, p Predictor) (int64, error) {
+	enc := NewArithEncoder(w)
+	in := bitio.NewBitReader(r, bitio.MSB)
+	for {
+		bit, err := in.ReadBit()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return in.BitsRead() / 8, err
+		}
+		err = enc.Encode(bit, p.P1())
+		if err != nil {
+			return in.BitsRead() / 8, err
+		}
+		p.Update(bit)
+	}
+	return in.BitsRead() / 8, enc.Flush()
+}
+
+// DecodeBytes reads n bytes written by EncodeBytes from r and writes them to w.
+// p must start out in the same state as the Predictor given to EncodeBytes.
+func DecodeBytes(w io.Writer, r io.Reader, p Predictor, n int64) error {
+	dec, err := NewArithDecoder(r)
+	if err != nil {
+		return err
+	}
+	out := bitio.NewBitWriter(w, bitio.MSB)
+	for i := int64(0); i < 8*n; i++ {
+		bit, err := dec.Decode(p.P1())
+		if err != nil {
+			return err
+		}
+		p.Update(bit)
+		err = out.WriteBit(bit)
+		if err != nil {
+			return err
+		}
+	}
+	return out.Flush()
+}
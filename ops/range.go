@@ -0,0 +1,324 @@
+package ops
+
+import (
+	bitio "compression/bitio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Multi-symbol range coder with a 32 bit range, in the style of the LZMA range coder.
+// Based on Martin, "Range encoding: an algorithm for removing redundancy from a digitised message" (1979).
+//
+// Like ArithEncoder, the coder keeps an interval [low, low+rng) and narrows it to the part for each
+// symbol, but the part is picked from a whole table of frequencies at once, so bytes do not have to
+// be split into bits. With r = rng/total, symbol s gets
+//
+//	low += r * cum(s)
+//	rng  = r * freq(s)
+//
+// Whenever rng drops below 2^24, the top byte of low is written and both are shifted up by a byte.
+// low has a 33rd bit for carries. A written byte could still change when a carry comes in, so the
+// last byte is held back (cache), together with any 0xff bytes after it (cacheSize), until it is
+// known that no carry can reach it. The first byte written is always that empty cache, a zero.
+
+// MaxTotal is the largest total frequency a table can have. Since rng is at least 2^24 before
+// every symbol, r is then at least 2^8, so rounding it down costs little.
+const MaxTotal = 1 << 16
+
+const rangeTop = uint32(1) << 24
+
+var errFreq = errors.New("ops: symbol frequency out of range")
+
+// RangeEncoder codes symbols with given frequencies and writes the result to an io.Writer.
+type RangeEncoder struct {
+	low       uint64
+	rng       uint32
+	cache     byte
+	cacheSize int64
+	out       *bitio.BitWriter
+}
+
+// NewRangeEncoder returns a RangeEncoder that writes to w. Nothing is written before Flush,
+// or before a few KB of output have built up.
+func NewRangeEncoder(w io.Writer) *RangeEncoder {
+	return &RangeEncoder{rng: 0xffffffff, cacheSize: 1, out: bitio.NewBitWriter(w, bitio.MSB)}
+}
+
+// Write the top byte of low, once no carry can change it.
+func (e *RangeEncoder) shiftLow() error {
+	if uint32(e.low) < 0xff000000 || e.low >= 1<<32 {
+		carry := byte(e.low >> 32)
+		b := e.cache
+		for ; e.cacheSize > 0; e.cacheSize-- {
+			err := e.out.WriteBits(uint64(b+carry), 8)
+			if err != nil {
+				return err
+			}
+			b = 0xff
+		}
+		e.cache = byte(e.low >> 24)
+	}
+	e.cacheSize++
+	e.low = (e.low & 0x00ffffff) << 8
+	return nil
+}
+
+// Encode codes the symbol that takes up [cum, cum+freq) out of total. total must be <= MaxTotal.
+func (e *RangeEncoder) Encode(cum uint32, freq uint32, total uint32) error {
+	if freq == 0 || cum+freq > total || total > MaxTotal {
+		return errFreq
+	}
+	r := e.rng / total
+	e.low += uint64(r * cum)
+	e.rng = r * freq
+	for e.rng < rangeTop {
+		e.rng <<= 8
+		err := e.shiftLow()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EncodeSymbol codes symbol s with the frequencies in t.
+func (e *RangeEncoder) EncodeSymbol(t *FreqTable, s int) error {
+	return e.Encode(t.cum[s], t.Freq(s), t.Total())
+}
+
+// Flush writes out low, which is inside the final interval, and everything held back.
+func (e *RangeEncoder) Flush() error {
+	for i := 0; i < 5; i++ {
+		err := e.shiftLow()
+		if err != nil {
+			return err
+		}
+	}
+	return e.out.Flush()
+}
+
+// RangeDecoder reads symbols written by RangeEncoder. It must be given the same frequencies,
+// in the same order, that the encoder was given.
+type RangeDecoder struct {
+	code uint32
+	rng  uint32
+	r    uint32
+	in   *bitio.BitReader
+}
+
+// NewRangeDecoder returns a RangeDecoder that reads from r.
+// If r is an io.ByteReader, no more is read from it than the coded data.
+func NewRangeDecoder(r io.Reader) (*RangeDecoder, error) {
+	d := &RangeDecoder{rng: 0xffffffff, in: bitio.NewBitReader(r, bitio.MSB)}
+	// The first byte is the encoder's empty cache.
+	for i := 0; i < 5; i++ {
+		b, err := d.readByte()
+		if err != nil {
+			return nil, err
+		}
+		d.code = d.code<<8 | b
+	}
+	return d, nil
+}
+
+// Read the next byte of coded data. Reading past the end of the data gives zeros.
+func (d *RangeDecoder) readByte() (uint32, error) {
+	b, err := d.in.ReadBits(8)
+	if err == io.EOF {
+		return 0, nil
+	}
+	return uint32(b), err
+}
+
+// GetFreq returns where the next symbol falls out of total, a number in [cum, cum+freq) for the
+// symbol. It must be followed by Decode with that symbol's cum and freq.
+func (d *RangeDecoder) GetFreq(total uint32) (uint32, error) {
+	if total == 0 || total > MaxTotal {
+		return 0, errFreq
+	}
+	d.r = d.rng / total
+	f := d.code / d.r
+	if f >= total {
+		// Only the encoder's rounding leaves room up here; valid data never lands in it.
+		return 0, fmt.Errorf("ops: corrupt range coded data")
+	}
+	return f, nil
+}
+
+// Decode removes the symbol that takes up [cum, cum+freq) from the input.
+func (d *RangeDecoder) Decode(cum uint32, freq uint32) error {
+	d.code -= d.r * cum
+	d.rng = d.r * freq
+	for d.rng < rangeTop {
+		b, err := d.readByte()
+		if err != nil {
+			return err
+		}
+		d.code = d.code<<8 | b
+		d.rng <<= 8
+	}
+	return nil
+}
+
+// DecodeSymbol returns the next symbol, with the frequencies in t.
+func (d *RangeDecoder) DecodeSymbol(t *FreqTable) (int, error) {
+	f, err := d.GetFreq(t.Total())
+	if err != nil {
+		return 0, err
+	}
+	s := t.Find(f)
+	return s, d.Decode(t.cum[s], t.Freq(s))
+}
+
+// FreqTable holds the frequencies of symbols 0 to n-1 as cumulative counts, for the range coder.
+// Symbols with frequency 0 can not be coded.
+type FreqTable struct {
+	cum []uint32 // cum[s] is the sum of the frequencies of the symbols before s, cum[n] the total
+}
+
+// NewFreqTable returns a table with the given frequencies, which must add up to no more than MaxTotal.
+func NewFreqTable(freqs []uint32) (*FreqTable, error) {
+	t := &FreqTable{cum: make([]uint32, len(freqs)+1)}
+	for s, f := range freqs {
+		if f > MaxTotal {
+			return nil, errFreq
+		}
+		t.cum[s+1] = t.cum[s] + f
+	}
+	if t.Total() == 0 || t.Total() > MaxTotal {
+		return nil, errFreq
+	}
+	return t, nil
+}
+
+// Total is the sum of all the frequencies.
+func (t *FreqTable) Total() uint32 {
+	return t.cum[len(t.cum)-1]
+}
+
+// Freq is the frequency of symbol s.
+func (t *FreqTable) Freq(s int) uint32 {
+	return t.cum[s+1] - t.cum[s]
+}
+
+// Find returns the symbol whose range [cum, cum+freq) holds f.
+func (t *FreqTable) Find(f uint32) int {
+	return sort.Search(len(t.cum)-1, func(s int) bool { return t.cum[s+1] > f })
+}
+
+// Add adds inc to the frequency of symbol s. If the total would go over MaxTotal, every frequency is
+// halved first, rounding up so that no symbol drops to 0. inc must leave room for one count per symbol.
+func (t *FreqTable) Add(s int, inc uint32) {
+	if int(inc)+len(t.cum)-1 > MaxTotal {
+		panic("ops: FreqTable.Add of too much")
+	}
+	for t.Total()+inc > MaxTotal {
+		prev := uint32(0)
+		for i := 0; i < len(t.cum)-1; i++ {
+			f := t.cum[i+1] - prev
+			prev = t.cum[i+1]
+			t.cum[i+1] = t.cum[i] + (f+1)/2
+		}
+	}
+	for i := s + 1; i < len(t.cum); i++ {
+		t.cum[i] += inc
+	}
+}
+
+// Adaptive order-N byte model for the range coder: one FreqTable for every context of the last
+// N bytes, made when the context is first seen, with every byte starting at frequency 1.
+
+// MaxRangeOrder is the longest context EncodeBytesRange can use.
+const MaxRangeOrder = 3
+
+// How much a byte's frequency goes up every time it is seen.
+const rangeInc = 24
+
+type byteModel struct {
+	order   int
+	context uint32
+	tables  map[uint32]*FreqTable
+}
+
+func newByteModel(order int) (*byteModel, error) {
+	if order < 0 || order > MaxRangeOrder {
+		return nil, fmt.Errorf("ops: range coder order must be between 0 and %d", MaxRangeOrder)
+	}
+	return &byteModel{order: order, tables: map[uint32]*FreqTable{}}, nil
+}
+
+func (m *byteModel) table() *FreqTable {
+	t := m.tables[m.context]
+	if t == nil {
+		freqs := make([]uint32, 256)
+		for i := range freqs {
+			freqs[i] = 1
+		}
+		t, _ = NewFreqTable(freqs)
+		m.tables[m.context] = t
+	}
+	return t
+}
+
+func (m *byteModel) update(t *FreqTable, b byte) {
+	t.Add(int(b), rangeInc)
+	m.context = (m.context<<8 | uint32(b)) & (uint32(1)<<(8*m.order) - 1)
+}
+
+// EncodeBytesRange codes every byte read from r with an adaptive order-N model and the range coder,
+// and writes the result to w. It returns the number of bytes read, which DecodeBytesRange needs to stop.
+func EncodeBytesRange(w io.Writer, r io.Reader, order int) (int64, error) {
+	m, err := newByteModel(order)
+	if err != nil {
+		return 0, err
+	}
+	enc := NewRangeEncoder(w)
+	in := bitio.NewBitReader(r, bitio.MSB)
+	n := int64(0)
+	for {
+		b, err := in.ReadBits(8)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return n, err
+		}
+		t := m.table()
+		err = enc.EncodeSymbol(t, int(b))
+		if err != nil {
+			return n, err
+		}
+		m.update(t, byte(b))
+		n++
+	}
+	return n, enc.Flush()
+}
+
+// DecodeBytesRange reads n bytes written by EncodeBytesRange with the same order from r,
+// and writes them to w.
+func DecodeBytesRange(w io.Writer, r io.Reader, order int, n int64) error {
+	m, err := newByteModel(order)
+	if err != nil {
+		return err
+	}
+	dec, err := NewRangeDecoder(r)
+	if err != nil {
+		return err
+	}
+	out := bitio.NewBitWriter(w, bitio.MSB)
+	for i := int64(0); i < n; i++ {
+		t := m.table()
+		s, err := dec.DecodeSymbol(t)
+		if err != nil {
+			return err
+		}
+		m.update(t, byte(s))
+		err = out.WriteBits(uint64(s), 8)
+		if err != nil {
+			return err
+		}
+	}
+	return out.Flush()
+}
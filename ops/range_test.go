@@ -0,0 +1,121 @@
+package ops
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func sumFreqs(freqs []uint32) uint32 {
+	sum := uint32(0)
+	for _, f := range freqs {
+		sum += f
+	}
+	return sum
+}
+
+// Random symbols with random tables, some of them very skewed to force carries and long
+// runs of 0xff.
+func TestRangeCoder(t *testing.T) {
+	for seed := int64(1); seed <= 5; seed++ {
+		r := rand.New(rand.NewSource(seed))
+		tables := []*FreqTable{}
+		for i := 0; i < 8; i++ {
+			freqs := make([]uint32, 1+r.Intn(300))
+			for s := range freqs {
+				freqs[s] = uint32(r.Intn(MaxTotal / len(freqs)))
+			}
+			freqs[r.Intn(len(freqs))] += 1 + uint32(r.Intn(MaxTotal-int(sumFreqs(freqs))))
+			table, err := NewFreqTable(freqs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tables = append(tables, table)
+		}
+		which := make([]int, 20000)
+		syms := make([]int, len(which))
+		var buf bytes.Buffer
+		enc := NewRangeEncoder(&buf)
+		for i := range syms {
+			which[i] = r.Intn(len(tables))
+			table := tables[which[i]]
+			syms[i] = table.Find(uint32(r.Intn(int(table.Total()))))
+			if err := enc.EncodeSymbol(table, syms[i]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := enc.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		// The decoder reads no more than the coded data from an io.ByteReader.
+		trailer := []byte("trailer")
+		in := bytes.NewReader(append(buf.Bytes(), trailer...))
+		dec, err := NewRangeDecoder(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range syms {
+			s, err := dec.DecodeSymbol(tables[which[i]])
+			if err != nil || s != syms[i] {
+				t.Fatalf("seed %d: symbol %d is %d, %v, want %d", seed, i, s, err, syms[i])
+			}
+		}
+		if in.Len() != len(trailer) {
+			t.Errorf("seed %d: %d bytes left after the coded data, want %d", seed, in.Len(), len(trailer))
+		}
+	}
+}
+
+func TestBadFreqs(t *testing.T) {
+	for _, freqs := range [][]uint32{{}, {0, 0}, {MaxTotal, 1}} {
+		if _, err := NewFreqTable(freqs); err == nil {
+			t.Errorf("%v: no error", freqs)
+		}
+	}
+	enc := NewRangeEncoder(&bytes.Buffer{})
+	if enc.Encode(0, 0, 10) == nil || enc.Encode(5, 6, 10) == nil || enc.Encode(0, 1, MaxTotal+1) == nil {
+		t.Error("bad frequencies encoded")
+	}
+}
+
+// n bytes of made up English text, with words picked from a Zipf distribution.
+func testText(seed int64, n int) []byte {
+	r := rand.New(rand.NewSource(seed))
+	words := strings.Fields(`the of and to in a is that for it as was with be by on not he I this are
+		or his from at which but have an they you were her she there one all we their been has who
+		more would will if no when what so out up into can 1987 said about other than time only
+		these two may first then do any like my now over such our man me even most made after also`)
+	zipf := rand.NewZipf(r, 1.1, 2, uint64(len(words)-1))
+	var b bytes.Buffer
+	for b.Len() < n {
+		for i := r.Intn(15) + 3; i > 0; i-- {
+			b.WriteString(words[zipf.Uint64()])
+			b.WriteByte(' ')
+		}
+		b.WriteString([]string{". ", ", ", "?\n", ".\n\n"}[r.Intn(4)])
+	}
+	return b.Bytes()[:n]
+}
+
+func TestBytesRange(t *testing.T) {
+	text := testText(1, 100000)
+	prev := len(text)
+	for order := 0; order <= 3; order++ {
+		var enc bytes.Buffer
+		n, err := EncodeBytesRange(&enc, bytes.NewReader(text), order)
+		if err != nil || n != int64(len(text)) {
+			t.Fatalf("order %d: %d bytes, %v", order, n, err)
+		}
+		var dec bytes.Buffer
+		err = DecodeBytesRange(&dec, bytes.NewReader(enc.Bytes()), order, n)
+		if err != nil || !bytes.Equal(dec.Bytes(), text) {
+			t.Errorf("order %d: decoded data does not match, %v", order, err)
+		}
+		// Up to order 2, a longer context should code the text better.
+		if order <= 2 && enc.Len() >= prev {
+			t.Errorf("order %d: %d bytes, %d with a shorter context", order, enc.Len(), prev)
+		}
+		prev = enc.Len()
+	}
+}